@@ -0,0 +1,300 @@
+// Package ceacfake 提供 CEAC 签证状态查询页面（Status.aspx）的本地仿真站点，
+// 用于在不访问 ceac.state.gov 的情况下验证爬虫逻辑。
+//
+// 仿真站点按 fixtures 目录中录制的页面结构渲染查询表单、验证码图片、
+// 验证码错误提示、查询结果页和维护页面，申请数据来自 fixtures/applications.json。
+//
+// 示例:
+//
+//	server := ceacfake.NewServer()
+//	defer server.Close()
+//	ceacfake.RegisterCaptchaSolver()
+//	// CEAC_BASE_URL=server.URL  CAPTCHA_SOLVERS=fake
+package ceacfake
+
+import (
+	"bytes"
+	"crawler-visa/utils"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const (
+	// StatusPath 查询页面路径
+	StatusPath = "/CEACStatTracker/Status.aspx"
+	// CaptchaPath 验证码图片路径
+	CaptchaPath = "/CEACStatTracker/BotDetectCaptcha.ashx"
+	// DefaultCaptchaAnswer 默认的正确验证码，RegisterCaptchaSolver 注册的假识别器总是返回它
+	DefaultCaptchaAnswer = "ABCD"
+
+	// CaptchaErrorMessage 验证码错误时 CEAC 显示的提示
+	CaptchaErrorMessage = "The code entered does not match the code displayed on the page."
+	// NotFoundMessage 申请信息不匹配时 CEAC 显示的提示
+	NotFoundMessage = "Your search did not return any data."
+)
+
+const fieldPrefix = "ctl00$ContentPlaceHolder1$"
+
+//go:embed fixtures
+var fixtures embed.FS
+
+var templates = template.Must(template.ParseFS(fixtures, "fixtures/*.html"))
+
+// Application 仿真站点中的一条申请记录
+type Application struct {
+	VisaCategory   string `json:"visa_category"`
+	Location       string `json:"location"`
+	ApplicationID  string `json:"application_id"`
+	CaseNumber     string `json:"case_number"`
+	PassportNumber string `json:"passport_number"`
+	Surname        string `json:"surname"`
+	Status         string `json:"status"`
+	StatusContent  string `json:"status_content"`
+	Created        string `json:"created"`
+	LastUpdated    string `json:"last_updated"`
+}
+
+// ID 返回申请的查询标识：NIV 为 AA 申请号，IV 为案件号
+func (a Application) ID() string {
+	if a.VisaCategory == "IV" {
+		return a.CaseNumber
+	}
+	return a.ApplicationID
+}
+
+// Location 领区下拉框中的选项
+type Location struct {
+	Code string
+	Name string
+}
+
+// DefaultLocations 中国大陆及香港的领区
+var DefaultLocations = []Location{
+	{"BEJ", "CHINA, BEIJING"},
+	{"CHE", "CHINA, CHENGDU"},
+	{"GUZ", "CHINA, GUANGZHOU"},
+	{"SHG", "CHINA, SHANGHAI"},
+	{"SNY", "CHINA, SHENYANG"},
+	{"HNK", "HONG KONG"},
+}
+
+// Handler 实现 Status.aspx 查询流程的 http.Handler
+type Handler struct {
+	mu            sync.Mutex
+	captchaAnswer string
+	maintenance   bool
+	applications  map[string]Application
+	requests      int
+}
+
+// NewHandler 创建仿真站点，预先加载 fixtures/applications.json 中的申请
+func NewHandler() *Handler {
+	h := &Handler{captchaAnswer: DefaultCaptchaAnswer, applications: make(map[string]Application)}
+	data, err := fixtures.ReadFile("fixtures/applications.json")
+	if err != nil {
+		panic(err)
+	}
+	var applications []Application
+	if err := json.Unmarshal(data, &applications); err != nil {
+		panic(err)
+	}
+	for _, application := range applications {
+		h.AddApplication(application)
+	}
+	return h
+}
+
+// AddApplication 添加或覆盖一条申请记录
+func (h *Handler) AddApplication(application Application) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if application.VisaCategory == "" {
+		application.VisaCategory = "NIV"
+	}
+	h.applications[strings.ToUpper(application.ID())] = application
+}
+
+// SetCaptchaAnswer 设置被视为正确的验证码
+func (h *Handler) SetCaptchaAnswer(answer string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.captchaAnswer = answer
+}
+
+// SetMaintenance 切换维护模式，维护模式下所有请求都返回维护页面
+func (h *Handler) SetMaintenance(on bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maintenance = on
+}
+
+// Requests 返回收到的请求总数，可用于验证限流等行为
+func (h *Handler) Requests() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests++
+	maintenance := h.maintenance
+	h.mu.Unlock()
+
+	if maintenance {
+		h.render(w, "maintenance.html", nil)
+		return
+	}
+	switch r.URL.Path {
+	case StatusPath:
+		if r.Method == http.MethodPost {
+			h.handleSubmit(w, r)
+			return
+		}
+		h.renderForm(w, "NIV", "")
+	case CaptchaPath:
+		h.handleCaptcha(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleSubmit 处理签证类别回发和查询提交
+func (h *Handler) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	category := r.PostForm.Get(fieldPrefix + "Visa_Application_Type")
+	if category != "IV" {
+		category = "NIV"
+	}
+	if r.PostForm.Get("__VIEWSTATE") == "" || r.PostForm.Get("__EVENTVALIDATION") == "" {
+		http.Error(w, "Invalid postback or callback argument", http.StatusInternalServerError)
+		return
+	}
+	// 下拉框触发的回发只重新渲染表单
+	if r.PostForm.Get("__EVENTTARGET") == fieldPrefix+"Visa_Application_Type" {
+		h.renderForm(w, category, "")
+		return
+	}
+
+	h.mu.Lock()
+	answer := h.captchaAnswer
+	h.mu.Unlock()
+	if !strings.EqualFold(strings.TrimSpace(r.PostForm.Get(fieldPrefix+"Captcha")), answer) {
+		h.renderForm(w, category, CaptchaErrorMessage)
+		return
+	}
+
+	application, ok := h.lookup(category, r)
+	if !ok {
+		h.renderForm(w, category, NotFoundMessage)
+		return
+	}
+	h.render(w, "result.html", map[string]string{
+		"ViewState":       randomToken(32),
+		"EventValidation": randomToken(16),
+		"Category":        application.VisaCategory,
+		"ID":              application.ID(),
+		"Status":          application.Status,
+		"StatusContent":   application.StatusContent,
+		"Created":         application.Created,
+		"LastUpdated":     application.LastUpdated,
+	})
+}
+
+// lookup 按表单内容查找申请，NIV 需要领区、护照号和姓氏全部匹配
+func (h *Handler) lookup(category string, r *http.Request) (Application, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	id := strings.ToUpper(strings.TrimSpace(r.PostForm.Get(fieldPrefix + "Visa_Case_Number")))
+	application, ok := h.applications[id]
+	if !ok || application.VisaCategory != category {
+		return Application{}, false
+	}
+	if category == "IV" {
+		return application, true
+	}
+	if !strings.EqualFold(r.PostForm.Get(fieldPrefix+"Location_Dropdown"), application.Location) ||
+		!strings.EqualFold(r.PostForm.Get(fieldPrefix+"Passport_Number"), application.PassportNumber) ||
+		!strings.HasPrefix(strings.ToUpper(application.Surname), strings.ToUpper(r.PostForm.Get(fieldPrefix+"Surname"))) {
+		return Application{}, false
+	}
+	return application, true
+}
+
+// handleCaptcha 返回一张简单的验证码图片，内容与答案无关，识别由假识别器完成
+func (h *Handler) handleCaptcha(w http.ResponseWriter) {
+	img := image.NewRGBA(image.Rect(0, 0, 180, 50))
+	for x := 0; x < 180; x++ {
+		for y := 0; y < 50; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y * 4), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+// renderForm 渲染查询表单，errorMessage 显示在 lblError 中
+func (h *Handler) renderForm(w http.ResponseWriter, category, errorMessage string) {
+	h.render(w, "status.html", map[string]interface{}{
+		"ViewState":       randomToken(32),
+		"EventValidation": randomToken(16),
+		"CaptchaToken":    randomToken(16),
+		"Category":        category,
+		"Locations":       DefaultLocations,
+		"Error":           errorMessage,
+	})
+}
+
+func (h *Handler) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("渲染仿真页面 %s 失败: %v", name, err)
+	}
+}
+
+// randomToken 生成随机的十六进制字符串，模拟 __VIEWSTATE 等每次变化的字段
+func randomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RegisterCaptchaSolver 注册名为 fake 的验证码识别器，总是返回 DefaultCaptchaAnswer，
+// 之后即可通过 CAPTCHA_SOLVERS=fake 使用。只应在测试或连接仿真站点时调用
+func RegisterCaptchaSolver() {
+	utils.RegisterCaptchaSolver("fake", func() (utils.CaptchaSolver, error) {
+		return utils.NewFakeCaptchaSolver(DefaultCaptchaAnswer), nil
+	})
+}
+
+// Server 基于 httptest 运行的仿真站点
+type Server struct {
+	*Handler
+	*httptest.Server
+}
+
+// NewServer 在本机随机端口启动仿真站点，URL 字段即 CEAC_BASE_URL
+func NewServer() *Server {
+	handler := NewHandler()
+	return &Server{Handler: handler, Server: httptest.NewServer(handler)}
+}
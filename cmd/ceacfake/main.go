@@ -0,0 +1,27 @@
+// ceacfake 在本地运行 CEAC 仿真站点，配合 CEAC_BASE_URL 和 CAPTCHA_SOLVERS=fake 离线验证爬虫。
+// 假识别器只在使用 ceacfake 构建标签编译的服务中可用。
+//
+//	go run ./cmd/ceacfake -addr :9011
+//	CEAC_BASE_URL=http://127.0.0.1:9011 CAPTCHA_SOLVERS=fake go run -tags ceacfake .
+package main
+
+import (
+	"crawler-visa/ceacfake"
+	"flag"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9011", "监听地址")
+	maintenance := flag.Bool("maintenance", false, "以维护模式启动")
+	captcha := flag.String("captcha", ceacfake.DefaultCaptchaAnswer, "被视为正确的验证码")
+	flag.Parse()
+
+	handler := ceacfake.NewHandler()
+	handler.SetMaintenance(*maintenance)
+	handler.SetCaptchaAnswer(*captcha)
+
+	log.Printf("CEAC 仿真站点已启动: http://%s%s", *addr, ceacfake.StatusPath)
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"github.com/joho/godotenv"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	envOnce sync.Once
+	envErr  error
+)
+
+// LoadEnv 加载项目根目录下的 .env 文件，多次调用只会加载一次。
+func LoadEnv() error {
+	envOnce.Do(func() {
+		envErr = godotenv.Load(".env")
+	})
+	return envErr
+}
+
+// GetEnv 读取字符串配置，未设置时返回默认值
+func GetEnv(key, def string) string {
+	_ = LoadEnv()
+	if v, ok := os.LookupEnv(key); ok && strings.TrimSpace(v) != "" {
+		return strings.TrimSpace(v)
+	}
+	return def
+}
+
+// GetEnvInt 读取整数配置，未设置或格式错误时返回默认值
+func GetEnvInt(key string, def int) int {
+	v, err := strconv.Atoi(GetEnv(key, ""))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// GetEnvFloat 读取浮点数配置，未设置或格式错误时返回默认值
+func GetEnvFloat(key string, def float64) float64 {
+	v, err := strconv.ParseFloat(GetEnv(key, ""), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// GetEnvBool 读取布尔配置，未设置或格式错误时返回默认值
+func GetEnvBool(key string, def bool) bool {
+	v, err := strconv.ParseBool(GetEnv(key, ""))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// GetEnvDuration 读取时长配置（如 "90s"、"5m"），未设置或格式错误时返回默认值
+func GetEnvDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(GetEnv(key, ""))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// GetEnvList 读取以逗号分隔的列表配置，忽略空项
+func GetEnvList(key string, def []string) []string {
+	raw := GetEnv(key, "")
+	if raw == "" {
+		return def
+	}
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"crawler-visa/service"
+	"crawler-visa/utils"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GetSelectors 返回当前生效的 CEAC 页面选择器及其版本
+func GetSelectors(w http.ResponseWriter, r *http.Request) {
+	utils.ResultJSON(w, service.CurrentSelectors(), "检索成功")
+}
+
+// ReloadSelectors 重新加载选择器文件，校验失败时保留原有选择器
+func ReloadSelectors(w http.ResponseWriter, r *http.Request) {
+	set, err := service.ReloadSelectors()
+	if err != nil {
+		utils.ResultError(w, err.Error(), http.StatusBadRequest)
+		log.Println("重新加载选择器失败:", err)
+		return
+	}
+	utils.ResultJSON(w, set, "重新加载成功")
+}
+
+// ListDiagnostics 返回最近的查询失败诊断包，可按 application_id / case_number 过滤，limit 默认 20
+func ListDiagnostics(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	bundles, err := service.DefaultDiagnosticsStore().List(applicationKey(r), limit)
+	if err != nil {
+		utils.ResultError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	utils.ResultJSON(w, bundles, "检索成功")
+}
+
+// DownloadDiagnostics 下载诊断包中的文件，file 为 screenshot.png、dom.html 或 bundle.json
+func DownloadDiagnostics(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	file := r.URL.Query().Get("file")
+	if id == "" || file == "" {
+		utils.ResultError(w, "id and file are required", http.StatusBadRequest)
+		return
+	}
+	path, err := service.DefaultDiagnosticsStore().Path(id, file)
+	if err != nil {
+		utils.ResultError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.ServeFile(w, r, path)
+}
+
+// GetCanaryResults 返回最近的 CEAC 页面巡检结果，最新的在前
+func GetCanaryResults(w http.ResponseWriter, r *http.Request) {
+	utils.ResultJSON(w, service.CanaryResults(), "检索成功")
+}
+
+// RunCanary 立即巡检一次 CEAC 查询页面，用于更新选择器后确认是否生效
+func RunCanary(w http.ResponseWriter, r *http.Request) {
+	utils.ResultJSON(w, service.RunCanary(r.Context()), "巡检完成")
+}
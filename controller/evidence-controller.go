@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"crawler-visa/service"
+	"crawler-visa/utils"
+	"net/http"
+)
+
+// ListEvidence 返回申请的全部查询证据，最新的在前
+func ListEvidence(w http.ResponseWriter, r *http.Request) {
+	appID := applicationKey(r)
+	if appID == "" {
+		utils.ResultError(w, "Application ID or case number is required", http.StatusBadRequest)
+		return
+	}
+	evidences, err := service.DefaultEvidenceArchive().List(appID)
+	if err != nil {
+		utils.ResultError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	utils.ResultJSON(w, evidences, "检索成功")
+}
+
+// DownloadEvidence 下载一次查询的证据文件，file 为 screenshot.jpg 或 result.html
+func DownloadEvidence(w http.ResponseWriter, r *http.Request) {
+	appID := applicationKey(r)
+	checkID := r.URL.Query().Get("check_id")
+	file := r.URL.Query().Get("file")
+	if appID == "" || checkID == "" || file == "" {
+		utils.ResultError(w, "application_id, check_id and file are required", http.StatusBadRequest)
+		return
+	}
+	path, err := service.DefaultEvidenceArchive().Path(appID, checkID, file)
+	if err != nil {
+		utils.ResultError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+appID+"-"+checkID+"-"+file+`"`)
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"crawler-visa/service"
+	"crawler-visa/utils"
+	"net/http"
+)
+
+// HealthStatus 健康检查接口返回的数据
+type HealthStatus struct {
+	CaptchaBalances []utils.BalanceSnapshot     `json:"captcha_balances"` // 打码平台余额
+	CaptchaReports  []utils.CaptchaReportCount  `json:"captcha_reports"`  // 最近的验证码报错与退分统计
+	CeacRateLimit   *service.RateLimitStats     `json:"ceac_rate_limit"`  // CEAC 访问限流状态
+	Proxies         []utils.ProxyStatus         `json:"proxies"`          // 代理池中各代理的健康状况
+	MailAccounts    []service.MailAccountStatus `json:"mail_accounts"`    // 护照查询邮箱今天的发送量
+}
+
+// Health 返回服务运行状态，包括打码平台剩余点数。
+// 传入 refresh=true 时会立即查询一次余额，否则返回定时任务最近一次查询的结果。
+// 手动刷新不会消耗低余额告警，余额不足时仍由定时任务通知管理员。
+func Health(w http.ResponseWriter, r *http.Request) {
+	balances := service.CaptchaBalances()
+	if r.URL.Query().Get("refresh") == "true" {
+		snapshots, err := service.RefreshCaptchaBalance(r.Context())
+		if err != nil {
+			utils.ResultError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		balances = snapshots
+	}
+	utils.ResultJSON(w, HealthStatus{
+		CaptchaBalances: balances,
+		CaptchaReports:  service.CaptchaReportHistory(),
+		CeacRateLimit:   service.CeacRateLimitStats(),
+		Proxies:         utils.DefaultProxyPool().Snapshot(),
+		MailAccounts:    service.MailAccountStats(),
+	}, "ok")
+}
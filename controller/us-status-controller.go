@@ -10,11 +10,12 @@ import (
 	"github.com/redis/go-redis/v9"
 	"log"
 	"net/http"
+	"sync"
 )
 
-// 全局上下文和Redis客户端初始化
+// 全局上下文和Redis客户端初始化，Redis 在第一次读写申请记录时才连接，查询接口不依赖 Redis
 var ctx = context.Background()
-var redisClient = config.ConfigureRedis()
+var redisClient = sync.OnceValue(config.ConfigureRedis)
 
 // Redis中用于存储应用状态的键的前缀
 const keyPrefix = "application:status:"
@@ -27,13 +28,18 @@ func CreateApplication(w http.ResponseWriter, r *http.Request) {
 	log.Println("开始创建应用状态") // 添加日志
 	queryUsStatus := &models.QueryUsStatus{}
 	utils.ParseBody(r, queryUsStatus)
+	if err := queryUsStatus.Validate(); err != nil {
+		utils.ResultError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	queryUsStatus.VisaCategory = queryUsStatus.Category()
 	marshal, err := json.Marshal(queryUsStatus)
 	if err != nil {
 		utils.ResultError(w, err.Error(), http.StatusInternalServerError)
 		log.Println("JSON编码失败:", err) // 添加错误日志
 		return
 	}
-	err = redisClient.Set(ctx, keyPrefix+queryUsStatus.ApplicationID, marshal, 0).Err()
+	err = redisClient().Set(ctx, keyPrefix+queryUsStatus.ID(), marshal, 0).Err()
 	if err != nil {
 		utils.ResultError(w, err.Error(), http.StatusInternalServerError)
 		log.Println("Redis写入失败:", err) // 添加错误日志
@@ -45,12 +51,12 @@ func CreateApplication(w http.ResponseWriter, r *http.Request) {
 
 // RetrieveApplication 通过Application ID从Redis获取签证申请记录
 func RetrieveApplication(w http.ResponseWriter, r *http.Request) {
-	appID := r.URL.Query().Get("application_id")
+	appID := applicationKey(r)
 	if appID == "" {
-		utils.ResultError(w, "Application ID is required", http.StatusInternalServerError)
+		utils.ResultError(w, "Application ID or case number is required", http.StatusInternalServerError)
 		return
 	}
-	result, err := redisClient.Get(ctx, keyPrefix+appID).Result()
+	result, err := redisClient().Get(ctx, keyPrefix+appID).Result()
 	if errors.Is(err, redis.Nil) {
 		utils.ResultError(w, "Application not found", http.StatusInternalServerError)
 		return
@@ -66,7 +72,12 @@ func RetrieveApplication(w http.ResponseWriter, r *http.Request) {
 func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 	queryUsStatus := &models.QueryUsStatus{}
 	utils.ParseBody(r, queryUsStatus)
-	exists, err := redisClient.Exists(ctx, keyPrefix+queryUsStatus.ApplicationID).Result()
+	if err := queryUsStatus.Validate(); err != nil {
+		utils.ResultError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	queryUsStatus.VisaCategory = queryUsStatus.Category()
+	exists, err := redisClient().Exists(ctx, keyPrefix+queryUsStatus.ID()).Result()
 	if err != nil {
 		utils.ResultError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -80,23 +91,23 @@ func UpdateApplication(w http.ResponseWriter, r *http.Request) {
 		utils.ResultError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	err = redisClient.Set(ctx, keyPrefix+queryUsStatus.ApplicationID, marshal, 0).Err()
+	err = redisClient().Set(ctx, keyPrefix+queryUsStatus.ID(), marshal, 0).Err()
 	if err != nil {
 		utils.ResultError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	utils.ResultJSON(w, nil, "修改成功")
-	log.Printf("更新应用状态成功：%s\n", queryUsStatus.ApplicationID) // 添加日志
+	log.Printf("更新应用状态成功：%s\n", queryUsStatus.ID()) // 添加日志
 }
 
 // DeleteApplication 通过Application ID删除Redis中的签证申请记录
 func DeleteApplication(w http.ResponseWriter, r *http.Request) {
-	appID := r.URL.Query().Get("application_id")
+	appID := applicationKey(r)
 	if appID == "" {
-		utils.ResultError(w, "Application ID is required", http.StatusInternalServerError)
+		utils.ResultError(w, "Application ID or case number is required", http.StatusInternalServerError)
 		return
 	}
-	result, err := redisClient.Del(ctx, keyPrefix+appID).Result()
+	result, err := redisClient().Del(ctx, keyPrefix+appID).Result()
 	if err != nil {
 		utils.ResultError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -109,13 +120,21 @@ func DeleteApplication(w http.ResponseWriter, r *http.Request) {
 	log.Printf("删除应用状态成功：%s\n", appID) // 添加日志
 }
 
+// applicationKey 从查询参数中读取记录标识，NIV 使用 application_id，IV 使用 case_number
+func applicationKey(r *http.Request) string {
+	if appID := r.URL.Query().Get("application_id"); appID != "" {
+		return appID
+	}
+	return r.URL.Query().Get("case_number")
+}
+
 // RetrieveAllApplications 从Redis获取所有签证申请记录
 func RetrieveAllApplications(w http.ResponseWriter, r *http.Request) {
 	var applications []models.QueryUsStatus
 
-	iter := redisClient.Scan(ctx, 0, keyPrefix+"*", 0).Iterator()
+	iter := redisClient().Scan(ctx, 0, keyPrefix+"*", 0).Iterator()
 	for iter.Next(ctx) {
-		result, err := redisClient.Get(ctx, iter.Val()).Result()
+		result, err := redisClient().Get(ctx, iter.Val()).Result()
 		if err != nil {
 			utils.ResultError(w, "Error retrieving application: "+err.Error(), http.StatusInternalServerError)
 			return
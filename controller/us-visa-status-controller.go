@@ -8,13 +8,25 @@ import (
 	"net/http"
 )
 
-func StatusCheck(w http.ResponseWriter, r *http.Request) {
+// VisaStatusController 提供签证状态和护照状态查询接口，查询实现通过构造函数注入
+type VisaStatusController struct {
+	Checker service.StatusChecker
+	Tracker service.PassportTracker
+}
+
+// NewVisaStatusController 创建查询接口控制器
+func NewVisaStatusController(checker service.StatusChecker, tracker service.PassportTracker) *VisaStatusController {
+	return &VisaStatusController{Checker: checker, Tracker: tracker}
+}
+
+func (c *VisaStatusController) StatusCheck(w http.ResponseWriter, r *http.Request) {
 	queryUsStatus := &models.QueryUsStatus{}
 	utils.ParseBody(r, queryUsStatus)
-	applicationCheck, err := service.RunVisaStatusCheck(queryUsStatus)
+	applicationCheck, err := c.Checker.CheckStatus(r.Context(), queryUsStatus)
 	applicationCheck.Code = 200
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		code, status := service.ErrorCode(err)
+		utils.ResultErrorCode(w, err.Error(), code, status)
 		return
 	}
 	res, _ := json.Marshal(applicationCheck)
@@ -23,13 +35,14 @@ func StatusCheck(w http.ResponseWriter, r *http.Request) {
 	w.Write(res)
 }
 
-func EmailTracking(w http.ResponseWriter, r *http.Request) {
+func (c *VisaStatusController) EmailTracking(w http.ResponseWriter, r *http.Request) {
 	queryUsStatus := &models.QueryUsStatus{}
 	utils.ParseBody(r, queryUsStatus)
-	applicationCheck, err := service.RunVisaEmailTracking(queryUsStatus)
+	applicationCheck, err := c.Tracker.TrackPassport(r.Context(), queryUsStatus)
 	applicationCheck.Code = 200
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		code, status := service.ErrorCode(err)
+		utils.ResultErrorCode(w, err.Error(), code, status)
 		return
 	}
 	res, _ := json.Marshal(applicationCheck)
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"crawler-visa/models"
+	"crawler-visa/service"
+	"crawler-visa/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postJSON(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestStatusCheck(t *testing.T) {
+	fake := service.NewFakeStatusChecker()
+	fake.SetStatus("AA00000001", models.UsStatus{Status: "Issued", CanonicalStatus: models.VisaStatusIssued})
+	fake.SetError("AA00000003", &service.CrawlError{Kind: service.ErrCeacMaintenance})
+	c := NewVisaStatusController(fake, fake)
+
+	w := postJSON(c.StatusCheck, `{"location":"GUZ","application_id":"AA00000001","passport_number":"E12345678","first_5_letters_of_surname":"ZHANG"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var status models.UsStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != "Issued" || status.CanonicalStatus != models.VisaStatusIssued || status.Code != 200 {
+		t.Errorf("unexpected result: %+v", status)
+	}
+
+	tests := []struct {
+		id        string
+		status    int
+		errorCode string
+	}{
+		{"AA00000002", http.StatusNotFound, "APPLICATION_NOT_FOUND"},
+		{"AA00000003", http.StatusServiceUnavailable, "CEAC_MAINTENANCE"},
+	}
+	for _, tt := range tests {
+		w := postJSON(c.StatusCheck, `{"location":"GUZ","application_id":"`+tt.id+`"}`)
+		var result utils.ResultData
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tt.status || result.ErrorCode != tt.errorCode {
+			t.Errorf("%s: got %d %s, want %d %s", tt.id, w.Code, result.ErrorCode, tt.status, tt.errorCode)
+		}
+	}
+
+	want := []string{"status:AA00000001", "status:AA00000002", "status:AA00000003"}
+	if calls := fake.Calls(); strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestEmailTracking(t *testing.T) {
+	fake := service.NewFakeStatusChecker()
+	fake.SetPassport("AA00000001", models.UsStatus{StatusContent: "Your passport is ready for pickup"})
+	fake.SetError("AA00000002", errors.New("unknown"))
+	c := NewVisaStatusController(fake, fake)
+
+	w := postJSON(c.EmailTracking, `{"application_id":"AA00000001","passport_number":"E12345678"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var status models.UsStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.StatusContent != "Your passport is ready for pickup" {
+		t.Errorf("unexpected result: %+v", status)
+	}
+
+	w = postJSON(c.EmailTracking, `{"application_id":"AA00000002","passport_number":"E12345679"}`)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "INTERNAL_ERROR") {
+		t.Errorf("got %d %s, want 500 INTERNAL_ERROR", w.Code, w.Body)
+	}
+}
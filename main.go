@@ -1,21 +1,64 @@
 package main
 
 import (
+	"context"
+	"crawler-visa/config"
+	"crawler-visa/controller"
 	"crawler-visa/router"
 	"crawler-visa/scheduler"
+	"crawler-visa/service"
+	"errors"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
+	selectors := service.CurrentSelectors()
+	log.Printf("CEAC 选择器版本: %s（%s）", selectors.Version, selectors.Source)
+
+	redisClient := config.ConfigureRedis()
+	ceacChecker := service.NewCeacStatusChecker()
+	// 接口的临时查询只返回探测到的领区，定时任务查询的是已保存的申请，探测结果写回 Redis
+	checker := service.NewLocationDiscoveryChecker(ceacChecker, service.CandidateLocations(), nil)
+	scheduledChecker := service.NewLocationDiscoveryChecker(ceacChecker,
+		service.CandidateLocations(), service.NewRedisLocationStore(redisClient))
+	tracker := service.NewEmailPassportTracker()
+
 	r := mux.NewRouter()
-	router.RegisterRouters(r)
-	scheduler.RunScheduledTasks()
+	router.RegisterRouters(r, controller.NewVisaStatusController(checker, tracker))
+	scheduler.RunScheduledTasks(service.NewRedisApplicationStore(redisClient), scheduledChecker, tracker)
+	scheduler.RunBalanceMonitor()
+	scheduler.RunBrowserReaper()
+	scheduler.RunCanaryMonitor()
+
+	server := &http.Server{Addr: "0.0.0.0:9010", Handler: setupCORS(r)}
+	go func() {
+		log.Println("Server is starting on 0.0.0.0:9010...")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// 收到退出信号后停止定时任务、关闭 HTTP 服务和浏览器
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("Server is shutting down...")
 
-	log.Println("Server is starting on 0.0.0.0:9010...")
-	log.Fatal(http.ListenAndServe("0.0.0.0:9010", setupCORS(r)))
+	scheduler.StopScheduledTasks()
+	service.ClosePassportPipeline() // 正在等待护照回复的请求立即返回
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP 服务关闭失败: %v", err)
+	}
+	service.CloseAllBrowsers()
 }
 
 // setupCORS wraps the router with CORS settings
@@ -0,0 +1,10 @@
+//go:build ceacfake
+
+package main
+
+import "crawler-visa/ceacfake"
+
+// 使用 ceacfake 构建标签编译时注册假识别器，用于连接本地仿真站点离线验证，生产构建中不存在
+func init() {
+	ceacfake.RegisterCaptchaSolver()
+}
@@ -7,3 +7,11 @@ type ChaoJiYing struct {
 	PicStr string `json:"pic_str"`
 	MD5    string `json:"md5"`
 }
+
+// ChaoJiYingScore 超级鹰题分查询接口的返回结果
+type ChaoJiYingScore struct {
+	ErrNo     int    `json:"err_no"`
+	ErrStr    string `json:"err_str"`
+	TiFen     int    `json:"tifen"`      // 剩余题分
+	TiFenLock int    `json:"tifen_lock"` // 锁定题分
+}
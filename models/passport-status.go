@@ -0,0 +1,241 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PassportState 是 ustraveldocs 回复邮件中护照状态的规范化值
+type PassportState string
+
+const (
+	PassportStateReadyForPickup PassportState = "READY_FOR_PICKUP" // 已到达领取地点，可以领取
+	PassportStateDispatched     PassportState = "DISPATCHED"       // 已从使领馆寄出，运送中
+	PassportStateDelivered      PassportState = "DELIVERED"        // 已送达（快递到家）
+	PassportStateCollected      PassportState = "COLLECTED"        // 已被领取
+	PassportStateNotFound       PassportState = "NOT_FOUND"        // 暂无该护照的记录，通常是护照尚未从使领馆发出
+	PassportStateUnknown        PassportState = "UNKNOWN"          // 无法识别的状态描述
+)
+
+// passportStateTexts 按匹配优先级排列的状态描述关键词（小写），
+// 如 "has been dispatched and is ready for pickup" 应识别为可以领取而不是运送中，"not yet been dispatched" 不是已寄出。
+// 否定说法必须排在对应的肯定说法之前
+var passportStateTexts = []struct {
+	text  string
+	state PassportState
+}{
+	{"not yet been dispatched", PassportStateNotFound},
+	{"not been dispatched", PassportStateNotFound},
+	{"not yet dispatched", PassportStateNotFound},
+	{"not been shipped", PassportStateNotFound},
+	{"not yet shipped", PassportStateNotFound},
+	{"not yet ready", PassportStateNotFound},
+	{"not ready for", PassportStateNotFound},
+	{"not available for", PassportStateNotFound},
+	{"not been collected", PassportStateReadyForPickup},
+	{"not been picked up", PassportStateReadyForPickup},
+	{"not been delivered", PassportStateDispatched},
+	{"尚未寄出", PassportStateNotFound},
+	{"未寄出", PassportStateNotFound},
+	{"不可领取", PassportStateNotFound},
+	{"不能领取", PassportStateNotFound},
+	{"未领取", PassportStateReadyForPickup},
+	{"has been collected", PassportStateCollected},
+	{"picked up by", PassportStateCollected},
+	{"已领取", PassportStateCollected},
+	{"has been delivered", PassportStateDelivered},
+	{"已签收", PassportStateDelivered},
+	{"已送达", PassportStateDelivered},
+	{"ready for pick", PassportStateReadyForPickup},
+	{"ready for collection", PassportStateReadyForPickup},
+	{"available for pick", PassportStateReadyForPickup},
+	{"available for collection", PassportStateReadyForPickup},
+	{"可以领取", PassportStateReadyForPickup},
+	{"可领取", PassportStateReadyForPickup},
+	{"待领取", PassportStateReadyForPickup},
+	{"dispatched", PassportStateDispatched},
+	{"in transit", PassportStateDispatched},
+	{"shipped", PassportStateDispatched},
+	{"on its way", PassportStateDispatched},
+	{"已寄出", PassportStateDispatched},
+	{"已发出", PassportStateDispatched},
+	{"运送中", PassportStateDispatched},
+	{"no record", PassportStateNotFound},
+	{"no information", PassportStateNotFound},
+	{"not been received", PassportStateNotFound},
+	{"unable to locate", PassportStateNotFound},
+	{"unable to find", PassportStateNotFound},
+	{"暂无", PassportStateNotFound},
+	{"未找到", PassportStateNotFound},
+	// 状态标签后通常只有一个词，如 "Status: Delivered"
+	{"collected", PassportStateCollected},
+	{"delivered", PassportStateDelivered},
+}
+
+// passportStateLabels 规范化状态对应的中文描述，用于通知文案
+var passportStateLabels = map[PassportState]string{
+	PassportStateReadyForPickup: "可以领取",
+	PassportStateDispatched:     "已寄出",
+	PassportStateDelivered:      "已送达",
+	PassportStateCollected:      "已领取",
+	PassportStateNotFound:       "暂无护照信息",
+	PassportStateUnknown:        "未知状态",
+}
+
+// PassportStatus 从 ustraveldocs 回复邮件中解析出的护照状态
+type PassportStatus struct {
+	PassportNumber string        `json:"passport_number"`
+	State          PassportState `json:"state"`                     // 规范化后的状态
+	Status         string        `json:"status"`                    // 邮件中的状态描述原文
+	Location       string        `json:"location,omitempty"`        // 领取地点或寄送地址
+	DispatchDate   string        `json:"dispatch_date,omitempty"`   // 寄出日期，保留邮件中的原始格式
+	TrackingNumber string        `json:"tracking_number,omitempty"` // 快递单号
+	ReceivedAt     time.Time     `json:"received_at"`               // 回复邮件的收件时间
+	Text           string        `json:"text"`                      // 邮件正文的纯文本
+}
+
+// 各字段在邮件中的标签，标签后跟冒号，值在同一行或下一行
+var (
+	passportStatusLabel   = labelPattern(`passport status`, `application status`, `status`, `护照状态`, `状态`)
+	passportLocationLabel = labelPattern(`(?:pick\s*-?\s*up|collection|delivery)\s+(?:location|address|point)`,
+		`location`, `address`, `领取地点`, `取件地点`, `寄送地址`, `地址`)
+	passportDispatchLabel = labelPattern(`dispatch(?:ed)?\s+date`, `date\s+(?:of\s+)?dispatch(?:ed)?`, `(?:shipment|ship|shipping)\s+date`,
+		`寄出日期`, `发出日期`, `寄送日期`)
+	passportTrackingLabel = labelPattern(`tracking\s*(?:number|no\.?|#)`, `(?:air\s*)?waybill\s*(?:number|no\.?)?`, `awb\s*(?:number|no\.?)?`,
+		`快递单号`, `运单号`)
+
+	followingPattern      = regexp.MustCompile(`(?i)the\s+following\s+(?:location|address)\s*[:：]\s*(.*)$`)
+	dispatchedOnPattern   = regexp.MustCompile(`(?i)dispatched\s+on\s+([0-9A-Za-z ,/-]+?)(?:\.|\s+(?:to|via|and|by)\b|$)`)
+	pickupAtPattern       = regexp.MustCompile(`(?i)ready\s+for\s+pick\s*-?\s*up\s+at\s+(.+?)(?:\.\s|\.$|$)`)
+	trackingNumberPattern = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9-]{5,}`)
+
+	// passportSubjectPattern 没有状态标签时，只从说到护照本身的句子中识别状态
+	passportSubjectPattern = regexp.MustCompile(`(?i)passport|护照|证件`)
+	// conditionalPattern 条件句或将来时，如 "You will be notified when your passport is dispatched"，
+	// 出现在状态关键词之前时说的不是当前状态
+	conditionalPattern = regexp.MustCompile(`(?i)\b(?:will|would|when|once|if|until|as soon as)\b|将会|将在|如果|一旦|届时|之后`)
+	sentenceEnd        = regexp.MustCompile(`[.;!?。；！？]\s*`)
+)
+
+// labelPattern 匹配以任一标签开头、后跟冒号的行，第 1 个分组为冒号后的内容
+func labelPattern(labels ...string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)^\s*(?:your\s+)?(?:` + strings.Join(labels, "|") + `)\s*[:：]\s*(.*)$`)
+}
+
+// labelValue 返回第一个匹配标签的行的值，冒号后为空时取下一行
+func labelValue(lines []string, pattern *regexp.Regexp) string {
+	for i, line := range lines {
+		m := pattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if value := strings.TrimSpace(m[1]); value != "" {
+			return value
+		}
+		if i+1 < len(lines) {
+			return strings.TrimSpace(lines[i+1])
+		}
+	}
+	return ""
+}
+
+// ParsePassportStatus 从回复邮件的纯文本中解析护照状态。
+// 优先读取 "Status:"、"Pickup Location:" 等带标签的行，没有标签时从正文句子中识别状态和领取地点。
+// text 应为按行排列的纯文本，HTML 邮件需先转换。
+func ParsePassportStatus(text string) PassportStatus {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	status := PassportStatus{Text: strings.Join(lines, "\n")}
+
+	status.Status = labelValue(lines, passportStatusLabel)
+	status.State = ParsePassportState(status.Status)
+	if status.State == PassportStateUnknown {
+		// 没有状态标签时，取第一句说到护照当前状态的正文，跳过条件句等邮件套话
+	search:
+		for _, line := range lines {
+			for _, sentence := range sentenceEnd.Split(line, -1) {
+				if !passportSubjectPattern.MatchString(sentence) {
+					continue
+				}
+				normalized := strings.ToLower(sentence)
+				state, at := matchPassportState(normalized)
+				if state == PassportStateUnknown || conditionalPattern.MatchString(normalized[:at]) {
+					continue
+				}
+				status.Status, status.State = line, state
+				break search
+			}
+		}
+	}
+
+	status.Location = labelValue(lines, passportLocationLabel)
+	if status.Location == "" {
+		status.Location = labelValue(lines, followingPattern)
+	}
+	if status.Location == "" {
+		if m := pickupAtPattern.FindStringSubmatch(status.Text); m != nil {
+			status.Location = strings.TrimSpace(m[1])
+		}
+	}
+	status.DispatchDate = labelValue(lines, passportDispatchLabel)
+	if status.DispatchDate == "" {
+		if m := dispatchedOnPattern.FindStringSubmatch(status.Text); m != nil {
+			status.DispatchDate = strings.TrimSpace(m[1])
+		}
+	}
+	if tracking := labelValue(lines, passportTrackingLabel); tracking != "" {
+		status.TrackingNumber = trackingNumberPattern.FindString(strings.ReplaceAll(tracking, " ", ""))
+	}
+	return status
+}
+
+// ParsePassportState 把状态描述转换为规范化状态，匹配不区分大小写，无法识别时返回 PassportStateUnknown
+func ParsePassportState(raw string) PassportState {
+	state, _ := matchPassportState(strings.ToLower(strings.Join(strings.Fields(raw), " ")))
+	return state
+}
+
+// matchPassportState 按优先级匹配状态关键词，返回状态和关键词在 normalized 中的位置
+func matchPassportState(normalized string) (PassportState, int) {
+	if normalized == "" {
+		return PassportStateUnknown, 0
+	}
+	for _, item := range passportStateTexts {
+		if at := strings.Index(normalized, item.text); at >= 0 {
+			return item.state, at
+		}
+	}
+	return PassportStateUnknown, 0
+}
+
+// Label 返回状态的中文描述
+func (s PassportState) Label() string {
+	if label, ok := passportStateLabels[s]; ok {
+		return label
+	}
+	return passportStateLabels[PassportStateUnknown]
+}
+
+// Summary 返回用于通知的一行摘要，如 "可以领取（地点：xxx，寄出日期：xxx，快递单号：xxx）"
+func (p *PassportStatus) Summary() string {
+	var details []string
+	if p.Location != "" {
+		details = append(details, "地点："+p.Location)
+	}
+	if p.DispatchDate != "" {
+		details = append(details, "寄出日期："+p.DispatchDate)
+	}
+	if p.TrackingNumber != "" {
+		details = append(details, "快递单号："+p.TrackingNumber)
+	}
+	if len(details) == 0 {
+		return p.State.Label()
+	}
+	return fmt.Sprintf("%s（%s）", p.State.Label(), strings.Join(details, "，"))
+}
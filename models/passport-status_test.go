@@ -0,0 +1,102 @@
+package models
+
+import "testing"
+
+func TestParsePassportStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		state    PassportState
+		location string
+		dispatch string
+		tracking string
+	}{
+		{
+			name: "带标签的可领取回复",
+			text: "Dear Applicant,\n\nPassport Number: E12345678\nStatus: Ready for pick up\n" +
+				"Pickup Location:\nCITIC Bank, Tianhe Branch, Guangzhou\n\nThank you.",
+			state:    PassportStateReadyForPickup,
+			location: "CITIC Bank, Tianhe Branch, Guangzhou",
+		},
+		{
+			name: "带寄出日期和快递单号",
+			text: "Passport Status: Dispatched\nDispatch Date: 12-Aug-2024\nTracking Number: SF 1234 5678 90\n" +
+				"You will be notified when your passport is ready for pick up.",
+			state:    PassportStateDispatched,
+			dispatch: "12-Aug-2024",
+			tracking: "SF1234567890",
+		},
+		{
+			name: "正文句子",
+			text: "Dear Applicant,\nThank you for your inquiry.\n" +
+				"Your passport has been dispatched and is ready for pick up at CITIC Bank Shanghai Branch.\nRegards",
+			state:    PassportStateReadyForPickup,
+			location: "CITIC Bank Shanghai Branch",
+		},
+		{
+			name:     "寄出后还会送达",
+			text:     "Your passport was dispatched on 12 Aug 2024 and will be delivered within 3 working days.",
+			state:    PassportStateDispatched,
+			dispatch: "12 Aug 2024",
+		},
+		{
+			name:  "尚未寄出",
+			text:  "Dear Applicant,\nYour passport has not yet been dispatched from the Embassy.",
+			state: PassportStateNotFound,
+		},
+		{
+			name:  "尚不能领取",
+			text:  "Your passport is not ready for pick up yet. Please check again later.",
+			state: PassportStateNotFound,
+		},
+		{
+			name:  "尚未领取",
+			text:  "Our records show that your passport has not been collected.",
+			state: PassportStateReadyForPickup,
+		},
+		{
+			name: "只有条件句套话",
+			text: "Dear Applicant,\nWe have received your inquiry.\n" +
+				"You will be notified by email when your passport is dispatched.\n" +
+				"Once your passport has been shipped, you can track it online.",
+			state: PassportStateUnknown,
+		},
+		{
+			name:  "与护照无关的句子",
+			text:  "Your inquiry has been dispatched to the relevant team.\nThis mailbox is not monitored.",
+			state: PassportStateUnknown,
+		},
+		{
+			name:  "中文回复",
+			text:  "尊敬的申请人：\n护照号码：E12345678\n护照状态：可以领取\n领取地点：中信银行广州天河支行",
+			state: PassportStateReadyForPickup, location: "中信银行广州天河支行",
+		},
+		{
+			name:  "中文否定说法",
+			text:  "尊敬的申请人：\n您的护照尚不能领取，请稍后再查询。",
+			state: PassportStateNotFound,
+		},
+		{
+			name:  "中文条件句",
+			text:  "尊敬的申请人：\n如果护照已寄出，我们会通过邮件通知您。",
+			state: PassportStateUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := ParsePassportStatus(tt.text)
+			if status.State != tt.state {
+				t.Errorf("State = %s (%q), want %s", status.State, status.Status, tt.state)
+			}
+			if status.Location != tt.location {
+				t.Errorf("Location = %q, want %q", status.Location, tt.location)
+			}
+			if status.DispatchDate != tt.dispatch {
+				t.Errorf("DispatchDate = %q, want %q", status.DispatchDate, tt.dispatch)
+			}
+			if status.TrackingNumber != tt.tracking {
+				t.Errorf("TrackingNumber = %q, want %q", status.TrackingNumber, tt.tracking)
+			}
+		})
+	}
+}
@@ -1,16 +1,65 @@
 package models
 
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	VisaCategoryNIV = "NIV" // 非移民签证
+	VisaCategoryIV  = "IV"  // 移民签证
+)
+
 type QueryUsStatus struct {
+	VisaCategory           string `json:"visa_category"` // 签证类别：NIV（默认）或 IV
 	Location               string `json:"location"`
 	ApplicationID          string `json:"application_id"`
+	CaseNumber             string `json:"case_number"` // 移民签证案件号，如 GUZ2023123456，仅 IV 使用
 	PassportNumber         string `json:"passport_number"`
 	First5LettersOfSurname string `json:"first_5_letters_of_surname"`
+	AutoLocation           bool   `json:"auto_location,omitempty"` // 申请信息不匹配时自动尝试其他候选领区，仅 NIV 使用
+}
+
+// Category 返回规范化后的签证类别，未填写时视为 NIV
+func (q *QueryUsStatus) Category() string {
+	if strings.EqualFold(strings.TrimSpace(q.VisaCategory), VisaCategoryIV) {
+		return VisaCategoryIV
+	}
+	return VisaCategoryNIV
+}
+
+// ID 返回用于存储和跟踪的唯一标识：NIV 为 AA 申请号，IV 为案件号
+func (q *QueryUsStatus) ID() string {
+	if q.Category() == VisaCategoryIV {
+		return q.CaseNumber
+	}
+	return q.ApplicationID
+}
+
+// Validate 检查对应签证类别在 CEAC 表单中必填的字段
+func (q *QueryUsStatus) Validate() error {
+	if q.Category() == VisaCategoryIV {
+		if q.CaseNumber == "" {
+			return errors.New("移民签证查询需要填写 case_number")
+		}
+		return nil
+	}
+	if q.Location == "" || q.ApplicationID == "" || q.PassportNumber == "" || q.First5LettersOfSurname == "" {
+		return errors.New("非移民签证查询需要填写 location、application_id、passport_number 和 first_5_letters_of_surname")
+	}
+	return nil
 }
 
 type UsStatus struct {
-	Status        string `json:"status"`
-	StatusContent string `json:"status_content"`
-	Created       string `json:"created"`
-	LastUpdated   string `json:"last_updated"`
-	Code          int    `json:"code"`
+	VisaCategory    string          `json:"visa_category"`
+	Status          string          `json:"status"`           // CEAC 页面上的原始状态文本
+	CanonicalStatus VisaStatus      `json:"canonical_status"` // 规范化后的状态值
+	StatusContent   string          `json:"status_content"`
+	Created         string          `json:"created"`
+	LastUpdated     string          `json:"last_updated"`
+	CaseNumber      string          `json:"case_number,omitempty"`      // 移民签证页面显示的案件号
+	EvidenceID      string          `json:"evidence_id,omitempty"`      // 本次查询保存的证据 ID，可通过证据接口下载截图和页面
+	MatchedLocation string          `json:"matched_location,omitempty"` // 自动探测到的正确领区，与填写的领区一致时为空
+	Passport        *PassportStatus `json:"passport,omitempty"`         // 护照状态查询时从回复邮件中解析出的结构化结果
+	Code            int             `json:"code"`
 }
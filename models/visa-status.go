@@ -0,0 +1,75 @@
+package models
+
+import "strings"
+
+// VisaStatus 是 CEAC 页面 .status 文本对应的规范化状态值
+type VisaStatus string
+
+const (
+	VisaStatusApplicationReceived      VisaStatus = "APPLICATION_RECEIVED"      // Application Received
+	VisaStatusAdministrativeProcessing VisaStatus = "ADMINISTRATIVE_PROCESSING" // Administrative Processing
+	VisaStatusRefused                  VisaStatus = "REFUSED"                   // Refused
+	VisaStatusIssued                   VisaStatus = "ISSUED"                    // Issued
+	VisaStatusReady                    VisaStatus = "READY"                     // Ready
+	VisaStatusTransferInProgress       VisaStatus = "TRANSFER_IN_PROGRESS"      // Transfer in Progress
+	VisaStatusAtNVC                    VisaStatus = "AT_NVC"                    // At NVC
+	VisaStatusInTransit                VisaStatus = "IN_TRANSIT"                // In Transit
+	VisaStatusNoStatus                 VisaStatus = "NO_STATUS"                 // No Status
+	VisaStatusApplicationExpired       VisaStatus = "APPLICATION_EXPIRED"       // Application Expired
+	VisaStatusUnknown                  VisaStatus = "UNKNOWN"                   // 无法识别的状态文本
+)
+
+// visaStatusTexts 按匹配优先级排列的 CEAC 原始状态文本（小写）
+var visaStatusTexts = []struct {
+	text   string
+	status VisaStatus
+}{
+	{"administrative processing", VisaStatusAdministrativeProcessing},
+	{"application received", VisaStatusApplicationReceived},
+	{"transfer in progress", VisaStatusTransferInProgress},
+	{"application expired", VisaStatusApplicationExpired},
+	{"at nvc", VisaStatusAtNVC},
+	{"in transit", VisaStatusInTransit},
+	{"no status", VisaStatusNoStatus},
+	{"refused", VisaStatusRefused},
+	{"issued", VisaStatusIssued},
+	{"ready", VisaStatusReady},
+}
+
+// visaStatusLabels 规范化状态对应的中文描述，用于通知文案
+var visaStatusLabels = map[VisaStatus]string{
+	VisaStatusApplicationReceived:      "已收到申请",
+	VisaStatusAdministrativeProcessing: "行政审查中",
+	VisaStatusRefused:                  "已拒签",
+	VisaStatusIssued:                   "已签发",
+	VisaStatusReady:                    "准备就绪",
+	VisaStatusTransferInProgress:       "转递中",
+	VisaStatusAtNVC:                    "在国家签证中心（NVC）",
+	VisaStatusInTransit:                "运送中",
+	VisaStatusNoStatus:                 "无状态",
+	VisaStatusApplicationExpired:       "申请已过期",
+	VisaStatusUnknown:                  "未知状态",
+}
+
+// ParseVisaStatus 把 CEAC 页面上的原始状态文本转换为规范化状态。
+// 匹配不区分大小写并忽略多余空白，无法识别时返回 VisaStatusUnknown。
+func ParseVisaStatus(raw string) VisaStatus {
+	normalized := strings.ToLower(strings.Join(strings.Fields(raw), " "))
+	if normalized == "" {
+		return VisaStatusUnknown
+	}
+	for _, item := range visaStatusTexts {
+		if strings.Contains(normalized, item.text) {
+			return item.status
+		}
+	}
+	return VisaStatusUnknown
+}
+
+// Label 返回状态的中文描述
+func (s VisaStatus) Label() string {
+	if label, ok := visaStatusLabels[s]; ok {
+		return label
+	}
+	return visaStatusLabels[VisaStatusUnknown]
+}
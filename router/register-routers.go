@@ -5,13 +5,25 @@ import (
 	"github.com/gorilla/mux"
 )
 
-var RegisterRouters = func(router *mux.Router) {
-	router.HandleFunc("/wuai/system/crawler_visa/us-visa-status", controller.StatusCheck).Methods("POST")
-	router.HandleFunc("/wuai/system/crawler_visa/us-visa-tracking", controller.EmailTracking).Methods("POST")
+var RegisterRouters = func(router *mux.Router, visaStatus *controller.VisaStatusController) {
+	router.HandleFunc("/wuai/system/crawler_visa/us-visa-status", visaStatus.StatusCheck).Methods("POST")
+	router.HandleFunc("/wuai/system/crawler_visa/us-visa-tracking", visaStatus.EmailTracking).Methods("POST")
 
 	router.HandleFunc("/wuai/system/crawler_visa/cn-us/create", controller.CreateApplication).Methods("POST")
 	router.HandleFunc("/wuai/system/crawler_visa/cn-us/get", controller.RetrieveApplication).Methods("GET")
 	router.HandleFunc("/wuai/system/crawler_visa/cn-us/update", controller.UpdateApplication).Methods("PUT")
 	router.HandleFunc("/wuai/system/crawler_visa/cn-us/delete", controller.DeleteApplication).Methods("DELETE")
 	router.HandleFunc("/wuai/system/crawler_visa/cn-us/all", controller.RetrieveAllApplications).Methods("GET")
+
+	router.HandleFunc("/wuai/system/crawler_visa/evidence", controller.ListEvidence).Methods("GET")
+	router.HandleFunc("/wuai/system/crawler_visa/evidence/download", controller.DownloadEvidence).Methods("GET")
+
+	router.HandleFunc("/wuai/system/crawler_visa/health", controller.Health).Methods("GET")
+
+	router.HandleFunc("/wuai/system/crawler_visa/admin/selectors", controller.GetSelectors).Methods("GET")
+	router.HandleFunc("/wuai/system/crawler_visa/admin/selectors/reload", controller.ReloadSelectors).Methods("POST")
+	router.HandleFunc("/wuai/system/crawler_visa/admin/canary", controller.GetCanaryResults).Methods("GET")
+	router.HandleFunc("/wuai/system/crawler_visa/admin/canary/run", controller.RunCanary).Methods("POST")
+	router.HandleFunc("/wuai/system/crawler_visa/admin/diagnostics", controller.ListDiagnostics).Methods("GET")
+	router.HandleFunc("/wuai/system/crawler_visa/admin/diagnostics/download", controller.DownloadDiagnostics).Methods("GET")
 }
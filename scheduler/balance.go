@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"crawler-visa/config"
+	"crawler-visa/service"
+	"crawler-visa/utils"
+	"fmt"
+	"time"
+)
+
+// RunBalanceMonitor 定期查询打码平台余额，余额低于 CJY_MIN_BALANCE 时通知管理员。
+// 轮询间隔由 CJY_BALANCE_POLL_INTERVAL 配置，默认 30 分钟。
+func RunBalanceMonitor() {
+	interval := config.GetEnvDuration("CJY_BALANCE_POLL_INTERVAL", 30*time.Minute)
+	sender := utils.NewNotificationSender(notificationURL())
+
+	check := func() {
+		_, alerts, err := service.CheckCaptchaBalance(ctx)
+		if err != nil {
+			fmt.Printf("查询打码平台余额错误: %v\n", err)
+			return
+		}
+		for _, snapshot := range alerts {
+			notifyAdmin(sender, "打码平台余额不足",
+				fmt.Sprintf("\n\n\n识别器：%s\n剩余点数：%d\n告警阈值：%d\n请尽快充值，否则签证状态查询将全部失败\n\n\n",
+					snapshot.Solver, snapshot.Points, snapshot.Threshold))
+		}
+	}
+
+	go func() {
+		check()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+			}
+		}
+	}()
+}
+
+// notificationURL 返回通知服务地址，可通过 NOTIFICATION_URL 覆盖
+func notificationURL() string {
+	return config.GetEnv("NOTIFICATION_URL", "https://apis.visa5i.com/wuai/system/wechat-notification/save")
+}
+
+// notifyAdmin 通过通知服务向管理员发送系统告警，接收人由 ADMIN_NOTIFY_USER 配置
+func notifyAdmin(sender *utils.NotificationSender, title, remark string) {
+	notificationData := utils.NotificationData{
+		Sys:        "crawler-visa",
+		ConsDist:   title,
+		MonCountry: "系统告警",
+		ApptTime:   time.Now().Format("2006-01-02 15:04:05"),
+		Status:     "2",
+		UserName:   config.GetEnv("ADMIN_NOTIFY_USER", "admin"),
+		Remark:     remark,
+	}
+	if err := sender.SendNotification(notificationData); err != nil {
+		fmt.Printf("Error sending admin notification: %v\n", err)
+	}
+}
@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"crawler-visa/config"
+	"crawler-visa/service"
+	"fmt"
+	"time"
+)
+
+// RunBrowserReaper 启动时及之后每隔 BROWSER_REAP_INTERVAL（默认 10 分钟）清理一次以前的服务进程遗留的浏览器
+func RunBrowserReaper() {
+	interval := config.GetEnvDuration("BROWSER_REAP_INTERVAL", 10*time.Minute)
+	reap := func() {
+		reaped, err := service.BrowserProcesses().ReapOrphans()
+		if err != nil {
+			fmt.Printf("清理遗留浏览器进程错误: %v\n", err)
+			return
+		}
+		if reaped > 0 {
+			fmt.Printf("已清理 %d 个遗留浏览器进程\n", reaped)
+		}
+	}
+
+	go func() {
+		reap()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reap()
+			}
+		}
+	}()
+}
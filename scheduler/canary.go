@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"crawler-visa/config"
+	"crawler-visa/service"
+	"crawler-visa/utils"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunCanaryMonitor 每隔 CANARY_INTERVAL（默认 1 小时）巡检一次 CEAC 查询页面。
+// 页面结构与选择器不符时通知管理员，恢复后再通知一次；页面打不开（维护、网络错误）不视为结构变化。
+// CANARY_ENABLED=false 时不启动。
+func RunCanaryMonitor() {
+	if !config.GetEnvBool("CANARY_ENABLED", true) {
+		return
+	}
+	interval := config.GetEnvDuration("CANARY_INTERVAL", time.Hour)
+	sender := utils.NewNotificationSender(notificationURL())
+	drifted := false
+
+	check := func() {
+		result := service.RunCanary(ctx)
+		if result.Error != "" {
+			fmt.Printf("CEAC 页面巡检未完成: %s\n", result.Error)
+			return
+		}
+		switch {
+		case result.Drifted && !drifted:
+			notifyAdmin(sender, "CEAC 页面结构变化",
+				fmt.Sprintf("\n\n\n选择器版本：%s\n缺少的选择器：%s\n验证码图片正常：%t\n请尽快更新选择器文件，否则签证状态查询将全部失败\n\n\n",
+					result.SelectorsVersion, strings.Join(result.Missing, ", "), result.CaptchaOK))
+		case !result.Drifted && drifted:
+			notifyAdmin(sender, "CEAC 页面巡检恢复",
+				fmt.Sprintf("\n\n\n选择器版本：%s\n所有选择器均已匹配\n\n\n", result.SelectorsVersion))
+		}
+		drifted = result.Drifted
+	}
+
+	go func() {
+		check()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+			}
+		}
+	}()
+}
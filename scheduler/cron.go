@@ -6,105 +6,165 @@ import (
 	"crawler-visa/models"
 	"crawler-visa/service"
 	"crawler-visa/utils"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
-var ctx = context.Background()
-var redisClient = config.ConfigureRedis()
+// ctx 为定时任务的根上下文，StopScheduledTasks 取消后正在执行的查询会立即中断
+var ctx, cancelTasks = context.WithCancel(context.Background())
 
-const keyPattern = "application:status:*"
+// retryDelay 可重试的错误之后等待多久再查询同一申请
+var retryDelay = 10 * time.Second
 
-func RunScheduledTasks() {
+// alertAbortCount 同一告警错误在一轮中出现多少个申请上时中止本轮查询，网站维护时立即中止
+const alertAbortCount = 2
+
+// RunScheduledTasks 每天 11:00 和 17:00 查询 store 中所有申请的签证状态和护照状态，状态变化时发送通知
+func RunScheduledTasks(store service.ApplicationStore, checker service.StatusChecker, passportTracker service.PassportTracker) {
 	tracker := utils.NewStatusTracker[models.UsStatus]()
-	sender := utils.NewNotificationSender("https://apis.visa5i.com/wuai/system/wechat-notification/save")
+	sender := utils.NewNotificationSender(notificationURL())
 
-	runTask := func() {
-		iter := redisClient.Scan(ctx, 0, keyPattern, 0).Iterator()
+	task := func() {
+		runTask(ctx, store, checker, passportTracker, tracker, sender)
+	}
 
-		for iter.Next(ctx) {
-			result, err := redisClient.Get(ctx, iter.Val()).Result()
-			if err != nil {
-				fmt.Printf("从Redis读取查询错误: %v\n", err)
-				continue
-			}
+	scheduleAt := func(hour, min int) time.Duration {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, now.Location())
+		if now.After(next) {
+			next = next.Add(24 * time.Hour)
+		}
+		return next.Sub(now)
+	}
 
-			var query models.QueryUsStatus
-			err = json.Unmarshal([]byte(result), &query)
-			if err != nil {
-				fmt.Printf("解析查询数据错误: %v\n", err)
-				continue
-			}
+	// Schedule for 11:00
+	time.AfterFunc(scheduleAt(11, 0), func() {
+		task()
+		time.AfterFunc(24*time.Hour, task) // Reschedule daily at 11:00
+	})
 
-			fmt.Printf("查询信息：%+v\n", query)
-			usStatus, err := service.RunVisaStatusCheck(&query)
-			usStatus.Code = 200
-			if err != nil {
-				fmt.Printf("检查签证状态错误: %v\n", err)
-				continue
-			}
-			changed := tracker.UpdateStatus(query.ApplicationID, usStatus)
-			if changed {
-				fmt.Printf("状态变更：%s, 新状态：%+v\n", query.ApplicationID, usStatus)
-				remark := utils.FormatVisaStatus(usStatus.Status, usStatus.StatusContent, usStatus.Created, usStatus.LastUpdated, query.ApplicationID, query.PassportNumber)
-
-				notificationData := utils.NotificationData{
-					Sys:        query.Location,
-					ConsDist:   "美签预约状态查询",
-					MonCountry: "美签预约状态查询",
-					ApptTime:   usStatus.LastUpdated,
-					Status:     "2",
-					UserName:   query.ApplicationID,
-					Remark:     remark,
-				}
-				err := sender.SendNotification(notificationData)
-				if err != nil {
-					fmt.Printf("Error sending notification: %v\n", err)
+	// Schedule for 17:00
+	time.AfterFunc(scheduleAt(17, 0), func() {
+		task()
+		time.AfterFunc(24*time.Hour, task) // Reschedule daily at 17:00
+	})
+}
+
+// StopScheduledTasks 取消所有正在执行的定时查询，用于服务关闭
+func StopScheduledTasks() {
+	cancelTasks()
+}
+
+// runTask 执行一轮定时查询：依次查询每个申请的签证状态，状态变化时通知用户，并在后台并行查询护照状态。
+// 遇到需要告警的错误时通知管理员并跳过本轮剩余申请，返回前等待本轮所有护照查询完成。
+func runTask(ctx context.Context, store service.ApplicationStore, checker service.StatusChecker, passportTracker service.PassportTracker,
+	tracker *utils.StatusTracker[models.UsStatus], sender *utils.NotificationSender) {
+	var passports sync.WaitGroup
+	defer passports.Wait() // 等待本轮所有护照查询完成
+
+	applications, err := store.ListApplications(ctx)
+	if err != nil {
+		fmt.Printf("读取申请记录错误: %v\n", err)
+	}
+	alerts := make(map[string]int) // 本轮各告警错误码出现的次数
+	for _, query := range applications {
+		fmt.Printf("查询信息：%+v\n", query)
+		usStatus, err := runStatusCheckWithRetry(ctx, checker, &query)
+		usStatus.Code = 200
+		if err != nil {
+			fmt.Printf("检查签证状态错误: %v\n", err)
+			if service.ErrorAction(err) == service.ActionAlert {
+				// 网站维护时后续申请必然失败，其他告警只有在多个申请上重复出现时才中止，避免个别申请影响整轮查询
+				code, _ := service.ErrorCode(err)
+				alerts[code]++
+				if errors.Is(err, service.ErrCeacMaintenance) || alerts[code] >= alertAbortCount {
+					notifyAdmin(sender, "签证状态定时查询中止",
+						fmt.Sprintf("\n\n\n错误码：%s\n错误信息：%v\n本轮剩余申请已跳过\n\n\n", code, err))
+					return
 				}
 			}
-			tracking, err := service.RunVisaEmailTracking(&query)
-			tracking.Code = 200
-			if err != nil {
-				fmt.Printf("检查签证状态错误: %v\n", err)
-				continue
-			}
-			remark := utils.FormatPassportStatus(tracking.StatusContent, query.PassportNumber)
+			continue
+		}
+		if usStatus.MatchedLocation != "" {
+			fmt.Printf("申请 %s 的领区已从 %s 更正为 %s\n", query.ID(), query.Location, usStatus.MatchedLocation)
+			query.Location = usStatus.MatchedLocation
+		}
+		changed := tracker.UpdateStatus(query.ID(), usStatus)
+		if changed {
+			fmt.Printf("状态变更：%s, 新状态：%s, 详情：%+v\n", query.ID(), usStatus.CanonicalStatus, usStatus)
+			remark := utils.FormatVisaStatus(usStatus.Status, usStatus.CanonicalStatus, usStatus.StatusContent, usStatus.Created, usStatus.LastUpdated, query.ID(), query.PassportNumber)
 
 			notificationData := utils.NotificationData{
 				Sys:        query.Location,
 				ConsDist:   "美签预约状态查询",
 				MonCountry: "美签预约状态查询",
-				ApptTime:   "美签护照状态查询",
+				ApptTime:   usStatus.LastUpdated,
 				Status:     "2",
-				UserName:   query.ApplicationID,
+				UserName:   query.ID(),
 				Remark:     remark,
 			}
-			err = sender.SendNotification(notificationData)
+			err := sender.SendNotification(notificationData)
 			if err != nil {
 				fmt.Printf("Error sending notification: %v\n", err)
 			}
 		}
+		if query.PassportNumber == "" {
+			continue // 没有护照号（如移民签证案件）时无法查询护照状态
+		}
+		// 护照查询要等待回复邮件，放到后台并行进行，不阻塞后续申请的签证状态查询
+		passports.Add(1)
+		go func() {
+			defer passports.Done()
+			trackPassport(ctx, passportTracker, sender, &query)
+		}()
 	}
+}
 
-	scheduleAt := func(hour, min int) time.Duration {
-		now := time.Now()
-		next := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, now.Location())
-		if now.After(next) {
-			next = next.Add(24 * time.Hour)
-		}
-		return next.Sub(now)
+// trackPassport 查询护照状态并发送通知
+func trackPassport(ctx context.Context, passportTracker service.PassportTracker, sender *utils.NotificationSender, query *models.QueryUsStatus) {
+	tracking, err := passportTracker.TrackPassport(ctx, query)
+	tracking.Code = 200
+	if err != nil {
+		fmt.Printf("检查护照状态错误: %s, %v\n", query.ID(), err)
+		return
 	}
+	content := tracking.StatusContent
+	if tracking.Passport != nil && tracking.Passport.State != models.PassportStateUnknown {
+		content = tracking.Passport.Summary()
+	}
+	remark := utils.FormatPassportStatus(content, query.PassportNumber)
 
-	// Schedule for 11:00
-	time.AfterFunc(scheduleAt(11, 0), func() {
-		runTask()
-		time.AfterFunc(24*time.Hour, runTask) // Reschedule daily at 11:00
-	})
+	notificationData := utils.NotificationData{
+		Sys:        query.Location,
+		ConsDist:   "美签预约状态查询",
+		MonCountry: "美签预约状态查询",
+		ApptTime:   "美签护照状态查询",
+		Status:     "2",
+		UserName:   query.ID(),
+		Remark:     remark,
+	}
+	err = sender.SendNotification(notificationData)
+	if err != nil {
+		fmt.Printf("Error sending notification: %v\n", err)
+	}
+}
 
-	// Schedule for 17:00
-	time.AfterFunc(scheduleAt(17, 0), func() {
-		runTask()
-		time.AfterFunc(24*time.Hour, runTask) // Reschedule daily at 17:00
-	})
+// runStatusCheckWithRetry 执行签证状态查询，遇到可重试的错误（验证码被拒、超时、浏览器崩溃）时
+// 最多再重试 SCHEDULER_MAX_RETRIES 次（默认 1 次），其余错误直接返回由调用方决定跳过或告警。
+func runStatusCheckWithRetry(ctx context.Context, checker service.StatusChecker, query *models.QueryUsStatus) (models.UsStatus, error) {
+	maxRetries := config.GetEnvInt("SCHEDULER_MAX_RETRIES", 1)
+	for retry := 0; ; retry++ {
+		usStatus, err := checker.CheckStatus(ctx, query)
+		if err == nil || service.ErrorAction(err) != service.ActionRetry || retry >= maxRetries {
+			return usStatus, err
+		}
+		fmt.Printf("签证状态查询失败，第 %d 次重试: %v\n", retry+1, err)
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return usStatus, err
+		}
+	}
 }
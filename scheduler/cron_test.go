@@ -0,0 +1,163 @@
+package scheduler
+
+import (
+	"context"
+	"crawler-visa/models"
+	"crawler-visa/service"
+	"crawler-visa/utils"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// memoryStore 内存中的申请记录
+type memoryStore []models.QueryUsStatus
+
+func (s memoryStore) ListApplications(ctx context.Context) ([]models.QueryUsStatus, error) {
+	return s, nil
+}
+
+// notificationRecorder 记录发往通知服务的通知
+type notificationRecorder struct {
+	mu            sync.Mutex
+	notifications []utils.NotificationData
+}
+
+func (n *notificationRecorder) sender(t *testing.T) *utils.NotificationSender {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data utils.NotificationData
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			t.Errorf("decode notification: %v", err)
+		}
+		n.mu.Lock()
+		n.notifications = append(n.notifications, data)
+		n.mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return utils.NewNotificationSender(server.URL)
+}
+
+// titles 返回通知的标题（ApptTime 或管理员告警的 ConsDist）和用户名
+func (n *notificationRecorder) titles() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var titles []string
+	for _, data := range n.notifications {
+		if data.MonCountry == "系统告警" {
+			titles = append(titles, "alert:"+data.ConsDist)
+		} else {
+			titles = append(titles, data.UserName+":"+data.ApptTime)
+		}
+	}
+	return titles
+}
+
+func niv(id, passport string) models.QueryUsStatus {
+	return models.QueryUsStatus{Location: "GUZ", ApplicationID: id, PassportNumber: passport, First5LettersOfSurname: "ZHANG"}
+}
+
+func TestRunTask(t *testing.T) {
+	t.Setenv("SCHEDULER_MAX_RETRIES", "1")
+	delay := retryDelay
+	retryDelay = 0
+	t.Cleanup(func() { retryDelay = delay })
+
+	fake := service.NewFakeStatusChecker()
+	fake.SetStatus("AA00000001", models.UsStatus{Status: "Issued", LastUpdated: "01-Aug-2024"})
+	fake.SetPassport("AA00000001", models.UsStatus{StatusContent: "ready for pickup"})
+	fake.SetError("AA00000002", &service.CrawlError{Kind: service.ErrCaptchaRejected})
+	fake.SetStatus("AA00000003", models.UsStatus{Status: "Refused", LastUpdated: "02-Aug-2024"})
+	store := memoryStore{niv("AA00000001", "E00000001"), niv("AA00000002", "E00000002"), niv("AA00000003", "")}
+
+	var recorder notificationRecorder
+	sender := recorder.sender(t)
+	tracker := utils.NewStatusTracker[models.UsStatus]()
+
+	runTask(context.Background(), store, fake, fake, tracker, sender)
+	want := []string{"status:AA00000001", "status:AA00000002", "status:AA00000002", "status:AA00000003", "passport:AA00000001"}
+	if got := fake.Calls(); !sameElements(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+	wantTitles := []string{"AA00000001:01-Aug-2024", "AA00000001:美签护照状态查询", "AA00000003:02-Aug-2024"}
+	if got := recorder.titles(); !sameElements(got, wantTitles) {
+		t.Errorf("notifications = %v, want %v", got, wantTitles)
+	}
+
+	// 状态没有变化时不再通知签证状态，护照状态每轮都会通知
+	runTask(context.Background(), store, fake, fake, tracker, sender)
+	wantTitles = append(wantTitles, "AA00000001:美签护照状态查询")
+	if got := recorder.titles(); !sameElements(got, wantTitles) {
+		t.Errorf("notifications = %v, want %v", got, wantTitles)
+	}
+}
+
+func TestRunTaskAlert(t *testing.T) {
+	fake := service.NewFakeStatusChecker()
+	fake.SetError("AA00000001", &service.CrawlError{Kind: service.ErrCeacMaintenance})
+	fake.SetStatus("AA00000002", models.UsStatus{Status: "Issued"})
+	store := memoryStore{niv("AA00000001", ""), niv("AA00000002", "")}
+
+	var recorder notificationRecorder
+	runTask(context.Background(), store, fake, fake, utils.NewStatusTracker[models.UsStatus](), recorder.sender(t))
+	if got, want := fake.Calls(), []string{"status:AA00000001"}; !sameElements(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+	if got, want := recorder.titles(), []string{"alert:签证状态定时查询中止"}; !sameElements(got, want) {
+		t.Errorf("notifications = %v, want %v", got, want)
+	}
+}
+
+func TestRunTaskAlertRepeated(t *testing.T) {
+	fake := service.NewFakeStatusChecker()
+	unavailable := &service.CrawlError{Kind: service.ErrCaptchaSolverUnavailable}
+	fake.SetError("AA00000001", unavailable)
+	fake.SetStatus("AA00000002", models.UsStatus{Status: "Issued", LastUpdated: "01-Aug-2024"})
+	fake.SetError("AA00000003", unavailable)
+	fake.SetStatus("AA00000004", models.UsStatus{Status: "Issued"})
+	store := memoryStore{niv("AA00000001", ""), niv("AA00000002", ""), niv("AA00000003", ""), niv("AA00000004", "")}
+
+	// 单个申请的告警不影响其他申请，同一告警在第二个申请上出现时中止
+	var recorder notificationRecorder
+	runTask(context.Background(), store, fake, fake, utils.NewStatusTracker[models.UsStatus](), recorder.sender(t))
+	if got, want := fake.Calls(), []string{"status:AA00000001", "status:AA00000002", "status:AA00000003"}; !sameElements(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+	if got, want := recorder.titles(), []string{"AA00000002:01-Aug-2024", "alert:签证状态定时查询中止"}; !sameElements(got, want) {
+		t.Errorf("notifications = %v, want %v", got, want)
+	}
+}
+
+func TestRunTaskCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fake := service.NewFakeStatusChecker()
+	fake.SetStatus("AA00000001", models.UsStatus{Status: "Issued"})
+
+	var recorder notificationRecorder
+	runTask(ctx, memoryStore{niv("AA00000001", "E00000001")}, fake, fake, utils.NewStatusTracker[models.UsStatus](), recorder.sender(t))
+	if got := recorder.titles(); len(got) != 0 {
+		t.Errorf("notifications = %v, want none", got)
+	}
+}
+
+// sameElements 忽略顺序比较，护照查询在后台并行进行
+func sameElements(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, s := range got {
+		count[s]++
+	}
+	for _, s := range want {
+		count[s]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/models"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"log"
+)
+
+// ApplicationStore 提供定时任务需要查询的申请记录
+type ApplicationStore interface {
+	ListApplications(ctx context.Context) ([]models.QueryUsStatus, error)
+}
+
+// RedisApplicationStore 读取 Redis 中所有 application:status:<ID> 记录
+type RedisApplicationStore struct {
+	client *redis.Client
+}
+
+// NewRedisApplicationStore 创建基于 Redis 的申请记录存储
+func NewRedisApplicationStore(client *redis.Client) *RedisApplicationStore {
+	return &RedisApplicationStore{client: client}
+}
+
+// ListApplications 返回所有申请记录，读取或解析失败的单条记录记录日志后跳过
+func (s *RedisApplicationStore) ListApplications(ctx context.Context) ([]models.QueryUsStatus, error) {
+	var applications []models.QueryUsStatus
+	iter := s.client.Scan(ctx, 0, applicationKeyPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		result, err := s.client.Get(ctx, iter.Val()).Result()
+		if err != nil {
+			log.Printf("从Redis读取查询错误: %v", err)
+			continue
+		}
+		var query models.QueryUsStatus
+		if err := json.Unmarshal([]byte(result), &query); err != nil {
+			log.Printf("解析查询数据错误: %v", err)
+			continue
+		}
+		applications = append(applications, query)
+	}
+	return applications, iter.Err()
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/config"
+	"crawler-visa/utils"
+	"errors"
+	"fmt"
+	"github.com/chromedp/chromedp"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrBrowserPoolClosed 在浏览器池关闭后继续申请浏览器时返回
+var ErrBrowserPoolClosed = errors.New("浏览器池已关闭")
+
+// browserLaunchTimeout 启动或连接一个浏览器的最长时间，借出时的 ctx 更早结束时以 ctx 为准
+const browserLaunchTimeout = 30 * time.Second
+
+// AllocatorFunc 创建 chromedp 的 Allocator 上下文，决定浏览器如何启动或连接，slot 为浏览器在池中的编号
+type AllocatorFunc func(parent context.Context, slot int) (context.Context, context.CancelFunc)
+
+// BrowserPool 维护固定数量的长期运行的浏览器进程。
+// 每次查询从池中借出一个浏览器，并在其中创建独立的 BrowserContext（类似无痕窗口），
+// 查询之间互不共享 Cookie 和缓存。浏览器使用达到 maxUses 次或崩溃后会被回收重建。
+type BrowserPool struct {
+	allocator AllocatorFunc
+	maxUses   int
+
+	slots     chan *browserSlot
+	mu        sync.Mutex
+	all       []*browserSlot
+	closed    bool
+	closeOnce sync.Once
+}
+
+// browserSlot 池中的一个浏览器
+type browserSlot struct {
+	id            int
+	uses          int
+	allocCancel   context.CancelFunc
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
+	pid           int // 本地启动的浏览器进程 PID，远程浏览器为 0
+}
+
+// BrowserLease 表示一次从池中借出的浏览器标签页，使用完毕后必须调用 Release 归还
+type BrowserLease struct {
+	Ctx context.Context // 在该上下文上执行 chromedp.Run
+
+	pool      *BrowserPool
+	slot      *browserSlot
+	tabCancel context.CancelFunc
+	discard   bool
+	once      sync.Once
+}
+
+// NewBrowserPool 创建浏览器池，浏览器在第一次被借出时才会启动。
+// 参数:
+//
+//	size int - 池中浏览器数量，即最大并发查询数。
+//	maxUses int - 单个浏览器最多使用的次数，达到后关闭并重建，小于等于 0 表示不限制。
+//	allocator AllocatorFunc - 浏览器的启动方式。
+//
+// 返回值:
+//
+//	*BrowserPool - 新创建的浏览器池。
+func NewBrowserPool(size, maxUses int, allocator AllocatorFunc) *BrowserPool {
+	if size <= 0 {
+		size = 1
+	}
+	pool := &BrowserPool{
+		allocator: allocator,
+		maxUses:   maxUses,
+		slots:     make(chan *browserSlot, size),
+	}
+	for i := 0; i < size; i++ {
+		slot := &browserSlot{id: i + 1}
+		pool.all = append(pool.all, slot)
+		pool.slots <- slot
+	}
+	return pool
+}
+
+// Acquire 借出一个浏览器并在其中打开一个隔离的标签页。
+// 池中没有空闲浏览器时阻塞等待，直到有浏览器归还或 ctx 结束。
+// ctx 上绑定了代理（见 utils.WithProxy）时，标签页所在的 BrowserContext 使用该代理。
+func (p *BrowserPool) Acquire(ctx context.Context) (*BrowserLease, error) {
+	var slot *browserSlot
+	select {
+	case slot = <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		p.slots <- slot
+		return nil, ErrBrowserPoolClosed
+	}
+
+	if slot.browserCtx != nil && !slot.alive() {
+		log.Printf("浏览器 #%d 已崩溃，重新启动", slot.id)
+		slot.shutdown()
+	}
+	if slot.browserCtx == nil {
+		if err := p.start(ctx, slot); err != nil {
+			p.slots <- slot
+			return nil, err
+		}
+	}
+
+	var contextOpts []chromedp.CreateBrowserContextOption
+	var proxyUser *url.Userinfo
+	if proxy, _ := utils.ProxyFromContext(ctx); proxy != "" {
+		opt, user, err := browserContextProxy(proxy)
+		if err != nil {
+			p.slots <- slot
+			return nil, err
+		}
+		contextOpts, proxyUser = append(contextOpts, opt), user
+	}
+
+	tabCtx, tabCancel := chromedp.NewContext(slot.browserCtx, chromedp.WithNewBrowserContext(contextOpts...))
+	if proxyUser != nil {
+		if err := enableProxyAuth(tabCtx, proxyUser); err != nil {
+			tabCancel()
+			p.release(slot, false)
+			return nil, err
+		}
+	}
+	return &BrowserLease{Ctx: tabCtx, pool: p, slot: slot, tabCancel: tabCancel}, nil
+}
+
+// Discard 标记该浏览器已不可信（如查询超时卡死），归还时直接关闭并在下次借出时重建
+func (l *BrowserLease) Discard() {
+	l.discard = true
+}
+
+// Release 关闭标签页并把浏览器归还到池中，重复调用是安全的
+func (l *BrowserLease) Release() {
+	l.once.Do(func() {
+		l.tabCancel()
+		l.pool.release(l.slot, l.discard)
+	})
+}
+
+// Close 关闭池中所有浏览器，之后的 Acquire 会返回 ErrBrowserPoolClosed
+func (p *BrowserPool) Close() {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+
+		for range p.all {
+			slot := <-p.slots
+			slot.shutdown()
+			p.slots <- slot
+		}
+		log.Println("浏览器池已关闭")
+	})
+}
+
+// start 启动槽位对应的浏览器进程
+func (p *BrowserPool) start(ctx context.Context, slot *browserSlot) error {
+	// 浏览器会被之后的查询继续使用，不能挂在本次借出的 ctx 上；只有启动过程受 ctx 和 browserLaunchTimeout 限制
+	launchCtx, cancel := context.WithTimeout(ctx, browserLaunchTimeout)
+	defer cancel()
+	allocCtx, allocCancel := p.allocator(context.Background(), slot.id)
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
+	launched := make(chan error, 1)
+	go func() {
+		launched <- chromedp.Run(browserCtx)
+	}()
+	var err error
+	select {
+	case err = <-launched:
+	case <-launchCtx.Done():
+		err = fmt.Errorf("浏览器 #%d 启动超时: %w", slot.id, launchCtx.Err())
+	}
+	if err != nil {
+		browserCancel()
+		allocCancel()
+		return err
+	}
+	slot.allocCancel = allocCancel
+	slot.browserCtx = browserCtx
+	slot.browserCancel = browserCancel
+	slot.uses = 0
+	if c := chromedp.FromContext(browserCtx); c != nil && c.Browser != nil {
+		if proc := c.Browser.Process(); proc != nil {
+			browserProcesses.Track(slot.id, proc)
+			slot.pid = proc.Pid
+		}
+	}
+	log.Printf("浏览器 #%d 已启动", slot.id)
+	return nil
+}
+
+// release 归还浏览器，被丢弃、达到最大使用次数或已崩溃的浏览器会被关闭，下次借出时重建
+func (p *BrowserPool) release(slot *browserSlot, discard bool) {
+	slot.uses++
+	if discard {
+		log.Printf("浏览器 #%d 被标记为不可用，回收重建", slot.id)
+		slot.shutdown()
+	} else if !slot.alive() {
+		log.Printf("浏览器 #%d 已崩溃，等待下次使用时重建", slot.id)
+		slot.shutdown()
+	} else if p.maxUses > 0 && slot.uses >= p.maxUses {
+		log.Printf("浏览器 #%d 已使用 %d 次，回收重建", slot.id, slot.uses)
+		slot.shutdown()
+	}
+	p.slots <- slot
+}
+
+// alive 判断浏览器是否仍在运行
+func (s *browserSlot) alive() bool {
+	if s.browserCtx == nil || s.browserCtx.Err() != nil {
+		return false
+	}
+	c := chromedp.FromContext(s.browserCtx)
+	if c == nil || c.Browser == nil {
+		return false
+	}
+	select {
+	case <-c.Browser.LostConnection:
+		return false
+	default:
+		return true
+	}
+}
+
+// shutdown 关闭浏览器进程并清空槽位。
+// chromedp 只结束浏览器主进程，卡死或崩溃时子进程可能残留，因此最后结束整个进程组。
+func (s *browserSlot) shutdown() {
+	if s.browserCancel != nil {
+		s.browserCancel()
+	}
+	if s.allocCancel != nil {
+		s.allocCancel()
+	}
+	if s.pid != 0 {
+		if err := browserProcesses.Kill(s.pid); err != nil {
+			log.Printf("结束浏览器 #%d 进程组失败: %v", s.id, err)
+		}
+	}
+	s.browserCtx, s.browserCancel, s.allocCancel = nil, nil, nil
+	s.pid = 0
+	s.uses = 0
+}
+
+var (
+	browserPoolOnce sync.Once
+	browserPool     *BrowserPool
+	browserPoolErr  error
+)
+
+// DefaultBrowserPool 返回 HTTP 接口与定时任务共用的浏览器池。
+// 池大小由 BROWSER_POOL_SIZE 配置（默认 2），单个浏览器最大使用次数由 BROWSER_MAX_USES 配置（默认 50），
+// 浏览器启动方式见 BrowserProfileFromEnv。
+func DefaultBrowserPool() (*BrowserPool, error) {
+	browserPoolOnce.Do(func() {
+		profile, err := BrowserProfileFromEnv()
+		if err != nil {
+			browserPoolErr = err
+			return
+		}
+		log.Printf("浏览器启动模式: %s", profile.Mode)
+		browserPool = NewBrowserPool(
+			config.GetEnvInt("BROWSER_POOL_SIZE", 2),
+			config.GetEnvInt("BROWSER_MAX_USES", 50),
+			profile.Allocator(),
+		)
+	})
+	return browserPool, browserPoolErr
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// TestBrowserPoolLaunchBounded 浏览器一直连不上时，Acquire 在 ctx 结束时返回，不会无限等待
+func TestBrowserPoolLaunchBounded(t *testing.T) {
+	// 只接受连接、从不响应 WebSocket 握手的远程浏览器
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	pool := NewBrowserPool(1, 0, func(parent context.Context, slot int) (context.Context, context.CancelFunc) {
+		return chromedp.NewRemoteAllocator(parent, "ws://"+listener.Addr().String(), chromedp.NoModifyURL)
+	})
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := pool.Acquire(ctx); err == nil {
+		t.Fatal("Acquire() error = nil")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Acquire() returned after %s", elapsed)
+	}
+
+	// 启动失败后浏览器归还到池中，可以再次尝试
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(ctx); err == nil {
+		t.Fatal("second Acquire() error = nil")
+	}
+}
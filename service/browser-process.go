@@ -0,0 +1,162 @@
+package service
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// browserOwnerFlag 启动 Chrome 时附加的命令行参数，值为本进程的 PID 和启动时间（见 ownerFlagValue），
+// 用于在进程列表中识别本服务启动的浏览器，不会误杀机器上其他程序的 Chrome
+const browserOwnerFlag = "crawler-visa-owner"
+
+// BrowserProcess 一个由本服务启动的浏览器进程
+type BrowserProcess struct {
+	PID       int       `json:"pid"`
+	Slot      int       `json:"slot"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// markedProcess 进程列表中带有 browserOwnerFlag 的浏览器进程
+type markedProcess struct {
+	PID        int
+	Owner      int    // 启动它的 crawler-visa 进程 PID
+	OwnerStart string // 启动它的 crawler-visa 进程的启动时间，旧版本的标记没有
+}
+
+// BrowserProcessManager 记录本服务启动的浏览器进程。
+// 浏览器以独立进程组启动，关闭时结束整个进程组，避免渲染进程等子进程残留。
+type BrowserProcessManager struct {
+	mu        sync.Mutex
+	processes map[int]BrowserProcess
+}
+
+// NewBrowserProcessManager 创建浏览器进程管理器
+func NewBrowserProcessManager() *BrowserProcessManager {
+	return &BrowserProcessManager{processes: make(map[int]BrowserProcess)}
+}
+
+// browserProcesses 浏览器池使用的进程管理器
+var browserProcesses = NewBrowserProcessManager()
+
+// BrowserProcesses 返回浏览器池使用的进程管理器
+func BrowserProcesses() *BrowserProcessManager {
+	return browserProcesses
+}
+
+// Track 记录一个新启动的浏览器进程
+func (m *BrowserProcessManager) Track(slot int, proc *os.Process) {
+	if proc == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.processes[proc.Pid] = BrowserProcess{PID: proc.Pid, Slot: slot, StartedAt: time.Now()}
+}
+
+// Kill 结束浏览器进程组并停止跟踪，只处理由 Track 记录过的进程
+func (m *BrowserProcessManager) Kill(pid int) error {
+	m.mu.Lock()
+	_, ok := m.processes[pid]
+	delete(m.processes, pid)
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return killProcessGroup(pid)
+}
+
+// KillAll 结束所有跟踪中的浏览器，返回结束的数量
+func (m *BrowserProcessManager) KillAll() int {
+	killed := 0
+	for _, proc := range m.Tracked() {
+		if err := m.Kill(proc.PID); err != nil {
+			log.Printf("结束浏览器进程 %d 失败: %v", proc.PID, err)
+			continue
+		}
+		killed++
+	}
+	return killed
+}
+
+// Tracked 返回跟踪中的浏览器进程，按 PID 排序
+func (m *BrowserProcessManager) Tracked() []BrowserProcess {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	processes := make([]BrowserProcess, 0, len(m.processes))
+	for _, proc := range m.processes {
+		processes = append(processes, proc)
+	}
+	sort.Slice(processes, func(i, j int) bool { return processes[i].PID < processes[j].PID })
+	return processes
+}
+
+// ReapOrphans 结束以前的服务进程遗留的浏览器：带有 browserOwnerFlag，且启动它的服务进程已经不存在（见 ownerGone）。
+// 本进程启动的浏览器由浏览器池负责，不在这里处理。目前只支持 Linux，其他平台返回 0。
+func (m *BrowserProcessManager) ReapOrphans() (int, error) {
+	processes, err := listMarkedProcesses()
+	if err != nil {
+		return 0, err
+	}
+	reaped := 0
+	for _, proc := range processes {
+		if !ownerGone(proc) {
+			continue
+		}
+		if err := killProcessGroup(proc.PID); err != nil {
+			log.Printf("结束遗留浏览器进程 %d 失败: %v", proc.PID, err)
+			continue
+		}
+		log.Printf("已结束遗留浏览器进程 %d（启动它的服务进程 %d 已退出）", proc.PID, proc.Owner)
+		reaped++
+	}
+	return reaped, nil
+}
+
+// ownerFlagValue 返回 browserOwnerFlag 的值：本进程 PID，能取得启动时间时附加在冒号后面
+func ownerFlagValue() string {
+	pid := os.Getpid()
+	if start, ok := processStartTime(pid); ok {
+		return strconv.Itoa(pid) + ":" + start
+	}
+	return strconv.Itoa(pid)
+}
+
+// parseOwnerFlag 解析 browserOwnerFlag 的值，兼容只有 PID 的旧格式
+func parseOwnerFlag(value string) (owner int, start string, ok bool) {
+	pidValue, start, _ := strings.Cut(value, ":")
+	owner, err := strconv.Atoi(pidValue)
+	if err != nil {
+		return 0, "", false
+	}
+	return owner, start, true
+}
+
+// ownerGone 判断启动浏览器的服务进程是否已经退出。PID 会被复用，容器中的服务进程每次都是 PID 1，
+// 所以 PID 对应的进程还在时再比较启动时间，不同说明已经换成了另一个进程（包括重启后的本服务）
+func ownerGone(proc markedProcess) bool {
+	if !processAlive(proc.Owner) {
+		return true
+	}
+	if proc.OwnerStart == "" {
+		return false // 旧格式的标记无法区分，保守地当作仍在运行
+	}
+	start, ok := processStartTime(proc.Owner)
+	return ok && start != proc.OwnerStart
+}
+
+// CloseAllBrowsers 关闭浏览器池，并结束本服务启动的所有浏览器进程，不影响机器上的其他 Chrome
+func CloseAllBrowsers() error {
+	if pool, err := DefaultBrowserPool(); err == nil {
+		pool.Close()
+	}
+	if killed := browserProcesses.KillAll(); killed > 0 {
+		log.Printf("已结束 %d 个残留的浏览器进程", killed)
+	}
+	log.Println("所有浏览器已关闭")
+	return nil
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package service
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listMarkedProcesses 扫描 /proc，找出命令行带有 browserOwnerFlag 的浏览器主进程
+func listMarkedProcesses() ([]markedProcess, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	prefix := "--" + browserOwnerFlag + "="
+	var processes []markedProcess
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err != nil {
+			continue // 进程已退出或无权限
+		}
+		for _, arg := range bytes.Split(cmdline, []byte{0}) {
+			value, ok := strings.CutPrefix(string(arg), prefix)
+			if !ok {
+				continue
+			}
+			if owner, start, ok := parseOwnerFlag(value); ok {
+				processes = append(processes, markedProcess{PID: pid, Owner: owner, OwnerStart: start})
+			}
+			break
+		}
+	}
+	return processes, nil
+}
+
+// processStartTime 读取 /proc/<pid>/stat 中的进程启动时间（开机后的时钟滴答数），与 PID 一起唯一确定一个进程
+func processStartTime(pid int) (string, bool) {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return "", false
+	}
+	// 第 2 个字段是括号中的进程名，可能包含空格和括号，从最后一个右括号之后开始数
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return "", false
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return "", false
+	}
+	return fields[19], true // 第 22 个字段 starttime
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package service
+
+// listMarkedProcesses 非 Linux 平台不扫描进程列表，遗留浏览器需要手动清理
+func listMarkedProcesses() ([]markedProcess, error) {
+	return nil, nil
+}
+
+// processStartTime 非 Linux 平台不读取进程启动时间，只按 PID 标记
+func processStartTime(pid int) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestParseOwnerFlag(t *testing.T) {
+	cases := []struct {
+		value string
+		owner int
+		start string
+		ok    bool
+	}{
+		{"1234:987654", 1234, "987654", true},
+		{"1234", 1234, "", true}, // 旧格式
+		{"owner", 0, "", false},
+	}
+	for _, c := range cases {
+		owner, start, ok := parseOwnerFlag(c.value)
+		if owner != c.owner || start != c.start || ok != c.ok {
+			t.Errorf("parseOwnerFlag(%q) = %d, %q, %v, want %d, %q, %v", c.value, owner, start, ok, c.owner, c.start, c.ok)
+		}
+	}
+}
+
+// TestOwnerGone PID 还在但启动时间不同（PID 被复用）时，浏览器也算遗留
+func TestOwnerGone(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("只有 Linux 读取进程启动时间")
+	}
+	self := os.Getpid()
+	owner, start, ok := parseOwnerFlag(ownerFlagValue())
+	if !ok || owner != self || start == "" {
+		t.Fatalf("ownerFlagValue() = %q, want pid:start", ownerFlagValue())
+	}
+
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("无法启动子进程: %v", err)
+	}
+	cases := []struct {
+		name string
+		proc markedProcess
+		gone bool
+	}{
+		{"本进程启动", markedProcess{Owner: self, OwnerStart: start}, false},
+		{"PID 被复用", markedProcess{Owner: self, OwnerStart: start + "0"}, true},
+		{"旧格式标记", markedProcess{Owner: self}, false},
+		{"服务进程已退出", markedProcess{Owner: cmd.Process.Pid, OwnerStart: strconv.Itoa(1)}, true},
+	}
+	for _, c := range cases {
+		if gone := ownerGone(c.proc); gone != c.gone {
+			t.Errorf("%s: ownerGone = %v, want %v", c.name, gone, c.gone)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/config"
+	"fmt"
+	"github.com/chromedp/chromedp"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	BrowserModeLocal  = "local"  // 在本机启动 Chrome
+	BrowserModeRemote = "remote" // 连接已运行的 Chrome（如 sidecar 容器）的 DevTools 地址
+)
+
+// BrowserProfile 描述浏览器的启动方式
+type BrowserProfile struct {
+	Mode         string // local 或 remote
+	Headless     bool   // 本机模式下是否启用无头模式
+	WindowWidth  int    // 本机模式下的窗口宽度
+	WindowHeight int    // 本机模式下的窗口高度
+	ProxyServer  string // 本机模式下的代理地址，如 http://127.0.0.1:7890
+	UserDataDir  string // 本机模式下的用户数据目录，为空时使用临时目录
+	ExecPath     string // 本机模式下的 Chrome 可执行文件路径，为空时自动查找
+	RemoteURL    string // 远程模式下的 DevTools 地址，如 ws://chrome:9222 或 http://chrome:9222
+}
+
+// BrowserProfileFromEnv 从环境变量读取浏览器启动配置。
+//
+// 示例:
+//
+//	BROWSER_MODE=remote
+//	BROWSER_REMOTE_URL=ws://chrome-sidecar:9222
+func BrowserProfileFromEnv() (BrowserProfile, error) {
+	profile := BrowserProfile{
+		Mode:        strings.ToLower(config.GetEnv("BROWSER_MODE", BrowserModeLocal)),
+		Headless:    config.GetEnvBool("BROWSER_HEADLESS", false),
+		ProxyServer: config.GetEnv("BROWSER_PROXY", ""),
+		UserDataDir: config.GetEnv("BROWSER_USER_DATA_DIR", ""),
+		ExecPath:    config.GetEnv("BROWSER_EXEC_PATH", ""),
+		RemoteURL:   config.GetEnv("BROWSER_REMOTE_URL", ""),
+	}
+
+	width, height, err := parseWindowSize(config.GetEnv("BROWSER_WINDOW_SIZE", "1920x1080"))
+	if err != nil {
+		return profile, err
+	}
+	profile.WindowWidth, profile.WindowHeight = width, height
+
+	switch profile.Mode {
+	case BrowserModeLocal:
+	case BrowserModeRemote:
+		if profile.RemoteURL == "" {
+			return profile, fmt.Errorf("BROWSER_MODE=remote 时必须配置 BROWSER_REMOTE_URL")
+		}
+	default:
+		return profile, fmt.Errorf("未知的 BROWSER_MODE: %s", profile.Mode)
+	}
+	return profile, nil
+}
+
+// Allocator 根据配置返回浏览器池使用的 AllocatorFunc
+func (p BrowserProfile) Allocator() AllocatorFunc {
+	if p.Mode == BrowserModeRemote {
+		return func(parent context.Context, slot int) (context.Context, context.CancelFunc) {
+			return chromedp.NewRemoteAllocator(parent, p.RemoteURL)
+		}
+	}
+	return func(parent context.Context, slot int) (context.Context, context.CancelFunc) {
+		return chromedp.NewExecAllocator(parent, p.execOptions(slot)...)
+	}
+}
+
+// execOptions 生成本机启动 Chrome 的参数。
+// 多个浏览器不能共用同一个用户数据目录，因此每个槽位使用独立的子目录。
+func (p BrowserProfile) execOptions(slot int) []chromedp.ExecAllocatorOption {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.DisableGPU,
+		chromedp.Flag("headless", p.Headless),              // 是否启用无头模式
+		chromedp.WindowSize(p.WindowWidth, p.WindowHeight), // 设置屏幕分辨率
+		chromedp.Flag(browserOwnerFlag, ownerFlagValue()),  // 标记为本服务启动的浏览器
+		chromedp.ModifyCmdFunc(setProcessGroup),            // 独立进程组，关闭时连同子进程一起结束
+	)
+	if p.ProxyServer != "" {
+		opts = append(opts, chromedp.ProxyServer(p.ProxyServer))
+	}
+	if p.UserDataDir != "" {
+		opts = append(opts, chromedp.UserDataDir(filepath.Join(p.UserDataDir, fmt.Sprintf("browser-%d", slot))))
+	}
+	if p.ExecPath != "" {
+		opts = append(opts, chromedp.ExecPath(p.ExecPath))
+	}
+	return opts
+}
+
+// parseWindowSize 解析形如 1920x1080 的窗口尺寸
+func parseWindowSize(size string) (int, int, error) {
+	parts := strings.SplitN(strings.ToLower(size), "x", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("无效的窗口尺寸: %s", size)
+	}
+	width, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("无效的窗口宽度: %s", size)
+	}
+	height, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("无效的窗口高度: %s", size)
+	}
+	return width, height, nil
+}
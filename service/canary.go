@@ -0,0 +1,251 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crawler-visa/models"
+	"crawler-visa/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chromedp/chromedp"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// resultSelectorKeys 只出现在查询结果页或维护页的选择器，查询页上不存在，巡检时跳过
+var resultSelectorKeys = map[string]bool{
+	SelectorStatus:        true,
+	SelectorStatusContent: true,
+	SelectorSubmitDate:    true,
+	SelectorStatusDate:    true,
+	SelectorIvCaseNumber:  true,
+	SelectorResultPanel:   true,
+	SelectorMaintenance:   true,
+}
+
+// postbackSelectorKeys 选择签证类别回发后才出现的输入框，打开查询页时还不存在。
+// HTTP 巡检会像查询时一样回发一次 NIV 类别再检查，浏览器巡检只检查打开页面时就有的选择器
+var postbackSelectorKeys = map[string]bool{
+	SelectorLocation:       true,
+	SelectorCaseNumber:     true,
+	SelectorPassportNumber: true,
+	SelectorSurname:        true,
+}
+
+// CanaryResult 一次页面巡检的结果
+type CanaryResult struct {
+	CheckedAt        time.Time `json:"checked_at"`
+	Backend          string    `json:"backend"`
+	SelectorsVersion string    `json:"selectors_version"`
+	Passed           bool      `json:"passed"`            // 所有选择器都存在且验证码图片正常
+	Drifted          bool      `json:"drifted"`           // 页面能打开但结构与选择器不符，需要更新选择器
+	Missing          []string  `json:"missing,omitempty"` // 页面上找不到的选择器键名
+	Skipped          []string  `json:"skipped,omitempty"` // 未验证的选择器键名（结果页、维护页和浏览器巡检时回发后才出现的输入框）
+	CaptchaOK        bool      `json:"captcha_ok"`        // 验证码图片是否正常显示
+	Error            string    `json:"error,omitempty"`   // 页面打不开等非结构性错误
+	ErrorCode        string    `json:"error_code,omitempty"`
+	DurationMs       int64     `json:"duration_ms"`
+}
+
+// CanaryHistory 保存最近的巡检结果，并发安全
+type CanaryHistory struct {
+	mu      sync.Mutex
+	results []CanaryResult
+	keep    int
+}
+
+// NewCanaryHistory 创建巡检历史，只保留最近 keep 条
+func NewCanaryHistory(keep int) *CanaryHistory {
+	return &CanaryHistory{keep: keep}
+}
+
+// Record 记录一次巡检结果
+func (h *CanaryHistory) Record(result CanaryResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results = append(h.results, result)
+	if h.keep > 0 && len(h.results) > h.keep {
+		h.results = h.results[len(h.results)-h.keep:]
+	}
+}
+
+// List 返回巡检历史，最新的在前
+func (h *CanaryHistory) List() []CanaryResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	results := make([]CanaryResult, len(h.results))
+	for i, result := range h.results {
+		results[len(h.results)-1-i] = result
+	}
+	return results
+}
+
+var canaryHistory = NewCanaryHistory(200)
+
+// CanaryResults 返回最近的巡检结果，最新的在前
+func CanaryResults() []CanaryResult {
+	return canaryHistory.List()
+}
+
+// RunCanary 打开 CEAC 查询页面（不提交任何申请信息），检查当前选择器在页面上是否都存在、验证码图片能否正常显示，
+// 结果记录到巡检历史。查询方式与 CEAC_BACKEND 一致，同样受 CEAC 访问限流约束。
+func RunCanary(ctx context.Context) CanaryResult {
+	start := time.Now()
+	sel := CurrentSelectors()
+	result := CanaryResult{CheckedAt: start, Backend: statusBackend(), SelectorsVersion: sel.Version}
+
+	var present map[string]bool
+	var err error
+	if err = waitCeacTurn(ctx); err == nil {
+		if result.Backend == BackendHTTP {
+			present, result.CaptchaOK, err = canaryHTTP(ctx, sel)
+		} else {
+			present, result.CaptchaOK, err = canaryBrowser(ctx, sel)
+		}
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorCode, _ = ErrorCode(err)
+	} else {
+		keys := make([]string, 0, len(sel.Selectors))
+		for key := range sel.Selectors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			found, checked := present[key]
+			if !checked {
+				result.Skipped = append(result.Skipped, key)
+			} else if !found {
+				result.Missing = append(result.Missing, key)
+			}
+		}
+		result.Passed = len(result.Missing) == 0 && result.CaptchaOK
+		result.Drifted = !result.Passed
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	canaryHistory.Record(result)
+	if result.Passed {
+		log.Printf("CEAC 页面巡检通过（选择器版本 %s）", result.SelectorsVersion)
+	} else {
+		log.Printf("CEAC 页面巡检失败: 缺少 %v，验证码正常: %t，错误: %s", result.Missing, result.CaptchaOK, result.Error)
+	}
+	return result
+}
+
+// formSelectors 返回打开查询页时就应当存在的选择器
+func formSelectors(sel *SelectorSet) map[string]string {
+	selectors := make(map[string]string)
+	for key, selector := range sel.Selectors {
+		if !resultSelectorKeys[key] && !postbackSelectorKeys[key] {
+			selectors[key] = selector
+		}
+	}
+	return selectors
+}
+
+// canaryBrowser 使用浏览器池中的浏览器巡检
+func canaryBrowser(ctx context.Context, sel *SelectorSet) (map[string]bool, bool, error) {
+	pool, err := DefaultBrowserPool()
+	if err != nil {
+		return nil, false, err
+	}
+	lease, err := pool.Acquire(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, false, contextError(ctx, err)
+		}
+		return nil, false, &CrawlError{Kind: ErrBrowserCrashed, Detail: "启动浏览器失败", Cause: err}
+	}
+	defer lease.Release()
+	taskCtx, cancelTask := context.WithCancel(lease.Ctx)
+	defer cancelTask()
+	stop := context.AfterFunc(ctx, cancelTask)
+	defer stop()
+
+	var page string
+	if err := runStep(taskCtx, "打开查询页面",
+		chromedp.Navigate(ceacStatusURL()),
+		chromedp.OuterHTML("html", &page, chromedp.ByQuery),
+	); err != nil {
+		return nil, false, err
+	}
+	if isMaintenancePage(page, sel) {
+		return nil, false, &CrawlError{Kind: ErrCeacMaintenance}
+	}
+
+	selectors, err := json.Marshal(formSelectors(sel))
+	if err != nil {
+		return nil, false, err
+	}
+	present := make(map[string]bool)
+	if err := runStep(taskCtx, "检查页面选择器", chromedp.Evaluate(fmt.Sprintf(
+		`(() => { const out = {}; for (const [key, s] of Object.entries(%s)) out[key] = document.querySelector(s) !== null; return out; })()`,
+		selectors), &present)); err != nil {
+		return nil, false, err
+	}
+
+	captchaOK := false
+	if present[SelectorCaptchaImage] {
+		// 等待验证码图片加载完成，图片加载失败时 naturalWidth 为 0
+		err := runStep(taskCtx, "检查验证码图片", chromedp.Poll(fmt.Sprintf(
+			`(() => { const img = document.querySelector(%q); return !!img && img.complete && img.naturalWidth > 0; })()`,
+			sel.Get(SelectorCaptchaImage)), &captchaOK, chromedp.WithPollingTimeout(10*time.Second)))
+		if err != nil && !errors.Is(err, chromedp.ErrPollingTimeout) {
+			return nil, false, err
+		}
+	}
+	return present, captchaOK, nil
+}
+
+// canaryHTTP 不启动浏览器，直接解析页面 HTML 巡检
+func canaryHTTP(ctx context.Context, sel *SelectorSet) (map[string]bool, bool, error) {
+	c, err := newCeacHTTPClient(sel)
+	if err != nil {
+		return nil, false, err
+	}
+	page, err := c.get(ctx, c.statusURL)
+	if err != nil {
+		return nil, false, err
+	}
+	if isMaintenancePage(page, sel) {
+		return nil, false, &CrawlError{Kind: ErrCeacMaintenance}
+	}
+
+	present := make(map[string]bool)
+	for key := range formSelectors(sel) {
+		present[key] = utils.FindElement(page, c.sel.Get(key)) != nil
+	}
+	if present[SelectorVisaAppType] {
+		postback, err := c.selectCategory(ctx, page, models.VisaCategoryNIV)
+		if err != nil {
+			return nil, false, err
+		}
+		for key := range postbackSelectorKeys {
+			if selector := c.sel.Get(key); selector != "" {
+				present[key] = utils.FindElement(postback, selector) != nil
+			}
+		}
+	}
+
+	captchaOK := false
+	if present[SelectorCaptchaImage] {
+		data, err := c.captchaImage(ctx, page)
+		if err != nil && !errors.Is(err, ErrCrawlFailed) {
+			return nil, false, err // 超时、维护等错误；图片请求失败时视为验证码异常
+		}
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil && cfg.Width > 0 {
+			captchaOK = true
+		}
+	}
+	return present, captchaOK, nil
+}
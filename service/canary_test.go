@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCanaryHTTP(t *testing.T) {
+	startCeacFake(t)
+	t.Setenv("CEAC_BACKEND", BackendHTTP)
+
+	result := RunCanary(context.Background())
+	if !result.Passed || result.Error != "" {
+		t.Fatalf("RunCanary() = %+v, want passed", result)
+	}
+	// 回发后才出现的输入框在 HTTP 巡检中同样被检查，只跳过结果页和维护页的选择器
+	for _, key := range result.Skipped {
+		if postbackSelectorKeys[key] {
+			t.Errorf("skipped %s, want it checked after the category postback", key)
+		}
+	}
+	if skipped := strings.Join(result.Skipped, ","); !strings.Contains(skipped, SelectorStatus) {
+		t.Errorf("skipped = %s, want result page selectors skipped", skipped)
+	}
+
+	server, _ := startCeacFake(t)
+	server.SetMaintenance(true)
+	if result := RunCanary(context.Background()); result.Drifted || result.ErrorCode != "CEAC_MAINTENANCE" {
+		t.Errorf("maintenance: RunCanary() = %+v, want CEAC_MAINTENANCE without drift", result)
+	}
+}
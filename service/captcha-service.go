@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/config"
+	"crawler-visa/utils"
+	"log"
+	"sync"
+)
+
+var (
+	solverMu      sync.Mutex
+	captchaSolver utils.CaptchaSolver
+
+	// captchaReportStats 按天统计被 CEAC 拒绝后向打码平台报错的次数
+	captchaReportStats = utils.NewCaptchaReportStats(30)
+
+	// balanceMonitor 记录打码平台余额，低于 CJY_MIN_BALANCE 时触发告警。
+	// 首次使用时才读取配置，保证 .env 已经加载
+	balanceMonitor = sync.OnceValue(func() *utils.BalanceMonitor {
+		return utils.NewBalanceMonitor(config.GetEnvInt("CJY_MIN_BALANCE", 1000))
+	})
+)
+
+// CaptchaReportHistory 返回最近 30 天的验证码报错与退分统计
+func CaptchaReportHistory() []utils.CaptchaReportCount {
+	return captchaReportStats.History()
+}
+
+// reportRejectedCaptcha 把被 CEAC 拒绝的识别结果报告给对应的打码平台，并计入当天统计
+func reportRejectedCaptcha(ctx context.Context, solver utils.CaptchaSolver, result utils.CaptchaResult) {
+	reporter, ok := solver.(utils.CaptchaReporter)
+	if !ok {
+		return
+	}
+	refunded, err := reporter.ReportError(ctx, result)
+	if err != nil {
+		log.Printf("验证码报错失败, 识别器: %s, 凭证: %s, 错误: %v", result.Solver, result.Ticket, err)
+		return
+	}
+	captchaReportStats.Record(refunded)
+	log.Printf("已报错验证码, 识别器: %s, 凭证: %s, 是否退分: %t", result.Solver, result.Ticket, refunded)
+}
+
+// SetCaptchaSolver 替换状态查询使用的验证码识别器，传入 nil 时恢复为按环境变量构建
+func SetCaptchaSolver(solver utils.CaptchaSolver) {
+	solverMu.Lock()
+	defer solverMu.Unlock()
+	captchaSolver = solver
+}
+
+// getCaptchaSolver 返回当前的验证码识别器，首次调用时按 CAPTCHA_SOLVERS 配置构建
+func getCaptchaSolver() (utils.CaptchaSolver, error) {
+	solverMu.Lock()
+	defer solverMu.Unlock()
+	if captchaSolver == nil {
+		solver, err := utils.NewCaptchaSolverFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		captchaSolver = solver
+	}
+	return captchaSolver, nil
+}
+
+// CheckCaptchaBalance 查询识别器链中所有支持余额查询的识别器，并更新余额监控。
+// 返回本次查询的快照以及需要发出低余额告警的快照。
+func CheckCaptchaBalance(ctx context.Context) ([]utils.BalanceSnapshot, []utils.BalanceSnapshot, error) {
+	return checkCaptchaBalance(ctx, balanceMonitor().Update)
+}
+
+// RefreshCaptchaBalance 立即查询余额并更新快照，不改变告警状态，低余额告警仍由定时任务发出
+func RefreshCaptchaBalance(ctx context.Context) ([]utils.BalanceSnapshot, error) {
+	snapshots, _, err := checkCaptchaBalance(ctx, func(solver string, points int, err error) (utils.BalanceSnapshot, bool) {
+		return balanceMonitor().Record(solver, points, err), false
+	})
+	return snapshots, err
+}
+
+// checkCaptchaBalance 查询所有支持余额查询的识别器，用 update 记录每个结果
+func checkCaptchaBalance(ctx context.Context, update func(solver string, points int, err error) (utils.BalanceSnapshot, bool)) ([]utils.BalanceSnapshot, []utils.BalanceSnapshot, error) {
+	solver, err := getCaptchaSolver()
+	if err != nil {
+		return nil, nil, err
+	}
+	solvers := []utils.CaptchaSolver{solver}
+	if chain, ok := solver.(*utils.CaptchaSolverChain); ok {
+		solvers = chain.Solvers()
+	}
+
+	var snapshots, alerts []utils.BalanceSnapshot
+	for _, s := range solvers {
+		checker, ok := s.(utils.CaptchaBalanceChecker)
+		if !ok {
+			continue
+		}
+		points, err := checker.Balance(ctx)
+		if err != nil {
+			log.Printf("查询识别器 %s 余额失败: %v", s.Name(), err)
+		}
+		snapshot, alert := update(s.Name(), points, err)
+		snapshots = append(snapshots, snapshot)
+		if alert {
+			alerts = append(alerts, snapshot)
+		}
+	}
+	return snapshots, alerts, nil
+}
+
+// CaptchaBalances 返回各识别器最近一次查询到的余额
+func CaptchaBalances() []utils.BalanceSnapshot {
+	return balanceMonitor().Snapshots()
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/config"
+	"crawler-visa/models"
+	"crawler-visa/utils"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	BackendChromedp = "chromedp" // 通过浏览器操作 CEAC 页面
+	BackendHTTP     = "http"     // 直接以 HTTP 表单方式提交 CEAC 页面，不需要浏览器
+)
+
+// ceacStatusURL 返回 CEAC 签证状态查询页面地址，CEAC_BASE_URL 可指向本地仿真站点（见 ceacfake 包）
+func ceacStatusURL() string {
+	base := strings.TrimRight(config.GetEnv("CEAC_BASE_URL", "https://ceac.state.gov"), "/")
+	return base + "/CEACStatTracker/Status.aspx"
+}
+
+// statusBackend 返回 CEAC_BACKEND 配置的查询方式，默认 chromedp
+func statusBackend() string {
+	return strings.ToLower(config.GetEnv("CEAC_BACKEND", BackendChromedp))
+}
+
+// ceacTransport 所有 HTTP 查询共用的连接池，每个请求使用其 ctx 上绑定的代理（即本次查询分配到的代理）
+var ceacTransport = func() *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = utils.ContextProxy
+	return tr
+}()
+
+// ceacHTTPClient 使用独立 Cookie 的 HTTP 客户端操作 Status.aspx，每次查询新建一个，相当于浏览器的无痕窗口
+type ceacHTTPClient struct {
+	client    *http.Client
+	statusURL string
+	sel       *SelectorSet
+}
+
+func newCeacHTTPClient(sel *SelectorSet) (*ceacHTTPClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ceacHTTPClient{
+		client:    &http.Client{Jar: jar, Transport: ceacTransport},
+		statusURL: ceacStatusURL(),
+		sel:       sel,
+	}, nil
+}
+
+// runHTTPStatusCheck 不启动浏览器，直接通过 HTTP 完成一次签证状态查询
+func runHTTPStatusCheck(ctx context.Context, usStatus *models.QueryUsStatus) (models.UsStatus, error) {
+	statusCheck, err := performHTTPStatusCheck(ctx, usStatus)
+	if err != nil && ctx.Err() != nil {
+		return models.UsStatus{}, contextError(ctx, err)
+	}
+	return statusCheck, err
+}
+
+func performHTTPStatusCheck(ctx context.Context, usStatus *models.QueryUsStatus) (models.UsStatus, error) {
+	log.Printf("Performing visa status check over HTTP, Category: %s, Location: %s, Application ID: %s, Case Number: %s\n",
+		usStatus.Category(), usStatus.Location, usStatus.ApplicationID, usStatus.CaseNumber)
+	var usStatusResult models.UsStatus
+
+	if err := usStatus.Validate(); err != nil {
+		return usStatusResult, &CrawlError{Kind: ErrInvalidQuery, Cause: err}
+	}
+
+	solver, err := getCaptchaSolver()
+	if err != nil {
+		return usStatusResult, &CrawlError{Kind: ErrCaptchaSolverUnavailable, Cause: err}
+	}
+
+	sel := CurrentSelectors()
+	ctx, trace := withCrawlTrace(ctx)
+	// fail 在返回或重试前保存诊断包
+	fail := func(err error) error {
+		saveDiagnostics(ctx, usStatus, BackendHTTP, sel, err)
+		return err
+	}
+
+	maxAttempts := 3
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		log.Printf("开始第 %d 签证状态查询表单（HTTP）", attempt)
+		trace.setAttempt(attempt)
+		if err := waitCeacTurn(ctx); err != nil {
+			return usStatusResult, err
+		}
+		c, err := newCeacHTTPClient(sel)
+		if err != nil {
+			return usStatusResult, err
+		}
+
+		page, err := c.get(ctx, c.statusURL)
+		if err != nil {
+			return usStatusResult, fail(err)
+		}
+		if isMaintenancePage(page, c.sel) {
+			return usStatusResult, fail(&CrawlError{Kind: ErrCeacMaintenance})
+		}
+		// 签证类别下拉框会触发回发，先提交一次类别，页面才会显示对应的输入框
+		page, err = c.selectCategory(ctx, page, usStatus.Category())
+		if err != nil {
+			return usStatusResult, fail(err)
+		}
+
+		imageBuf, err := c.captchaImage(ctx, page)
+		if err != nil {
+			return usStatusResult, fail(err)
+		}
+
+		log.Println("开始识别验证码")
+		result, err := solver.Solve(ctx, imageBuf)
+		if err != nil {
+			log.Printf("第 %d 次验证码识别失败: %v", attempt, err)
+			lastErr = fail(&CrawlError{Kind: ErrCaptchaSolverUnavailable, Cause: err})
+			continue // 识别失败，重新尝试
+		}
+		log.Printf("验证码识别结果: %s (识别器: %s, 凭证: %s)", result.Answer, result.Solver, result.Ticket)
+
+		resultPage, err := c.submit(ctx, page, usStatus, result.Answer)
+		if err != nil {
+			log.Printf("第 %d 次提交验证码失败: %v", attempt, err)
+			lastErr = fail(err)
+			continue // 提交失败，重新尝试
+		}
+		if pageError := c.text(resultPage, SelectorCaptchaError); pageError != "" {
+			log.Printf("第 %d 次验证码提交失败，错误信息: %s", attempt, pageError)
+			lastErr = fail(classifyPageError(pageError))
+			if !errors.Is(lastErr, ErrCaptchaRejected) {
+				return usStatusResult, lastErr // 申请信息有误，重试无意义
+			}
+			reportRejectedCaptcha(ctx, solver, result)
+			continue // 验证码提交失败，重新尝试
+		}
+
+		usStatusResult.StatusContent = c.text(resultPage, SelectorStatusContent)
+		usStatusResult.Status = c.text(resultPage, SelectorStatus)
+		usStatusResult.Created = c.text(resultPage, SelectorSubmitDate)
+		usStatusResult.LastUpdated = c.text(resultPage, SelectorStatusDate)
+		if usStatus.Category() == models.VisaCategoryIV {
+			usStatusResult.CaseNumber = c.text(resultPage, SelectorIvCaseNumber)
+		}
+		if usStatusResult.Status == "" && usStatusResult.StatusContent == "" {
+			log.Printf("第 %d 次获取签证状态信息失败: 结果页缺少状态元素", attempt)
+			lastErr = fail(newCrawlError(ErrSelectorTimeout, nil, "结果页缺少 %s", c.sel.Get(SelectorStatus)))
+			continue // 获取状态信息失败，重新尝试
+		}
+		usStatusResult.VisaCategory = usStatus.Category()
+		usStatusResult.CanonicalStatus = models.ParseVisaStatus(usStatusResult.Status)
+		// 没有浏览器无法截图，只保存结果页 HTML
+		archiveEvidence(usStatus, BackendHTTP, &usStatusResult, map[string][]byte{EvidenceResultHTML: []byte(resultPage)})
+
+		return usStatusResult, nil
+	}
+	return usStatusResult, fmt.Errorf("验证码识别失败超过最大尝试次数 %d 次: %w", maxAttempts, lastErr)
+}
+
+// do 发送请求并读取响应正文，网络错误归类为 CRAWL_FAILED，并受 STEP_TIMEOUT 限制。
+// 请求会记录到 ctx 上的步骤记录器，HTML 响应作为失败时诊断包中的 DOM
+func (c *ceacHTTPClient) do(ctx context.Context, req *http.Request, step string) (body []byte, err error) {
+	start := time.Now()
+	defer func() {
+		crawlTraceFrom(ctx).recordStep(step, start, err)
+	}()
+	stepCtx, cancel := context.WithTimeout(ctx, config.GetEnvDuration("STEP_TIMEOUT", 30*time.Second))
+	defer cancel()
+	req = req.WithContext(stepCtx)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, newCrawlError(ErrSelectorTimeout, err, "%s", step)
+		}
+		return nil, newCrawlError(ErrCrawlFailed, err, "%s", step)
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newCrawlError(ErrCrawlFailed, err, "%s", step)
+	}
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		crawlTraceFrom(ctx).recordPage(req.URL.String(), string(body))
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return nil, newCrawlError(ErrCeacMaintenance, nil, "%s: HTTP %d", step, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newCrawlError(ErrCrawlFailed, nil, "%s: HTTP %d", step, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// get 打开页面并返回 HTML
+func (c *ceacHTTPClient) get(ctx context.Context, pageURL string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	body, err := c.do(ctx, req, "打开查询页面")
+	return string(body), err
+}
+
+// post 回传表单并返回新的页面 HTML
+func (c *ceacHTTPClient) post(ctx context.Context, form url.Values, step string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, c.statusURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", c.statusURL)
+	body, err := c.do(ctx, req, step)
+	return string(body), err
+}
+
+// fieldName 根据选择器找到对应输入框的 name 属性，ASP.NET 以 name 而不是 id 接收表单
+func (c *ceacHTTPClient) fieldName(page, key string) (string, error) {
+	el := utils.FindElement(page, c.sel.Get(key))
+	if el == nil || el.Attrs["name"] == "" {
+		return "", newCrawlError(ErrSelectorTimeout, nil, "页面缺少 %s", c.sel.Get(key))
+	}
+	return el.Attrs["name"], nil
+}
+
+// text 返回选择器对应元素的文本，元素不存在时返回空字符串
+func (c *ceacHTTPClient) text(page, key string) string {
+	if el := utils.FindElement(page, c.sel.Get(key)); el != nil {
+		return el.Text()
+	}
+	return ""
+}
+
+// selectCategory 模拟签证类别下拉框的自动回发
+func (c *ceacHTTPClient) selectCategory(ctx context.Context, page, category string) (string, error) {
+	name, err := c.fieldName(page, SelectorVisaAppType)
+	if err != nil {
+		return "", err
+	}
+	form := formValues(utils.FormFields(page))
+	form.Set(name, category)
+	form.Set("__EVENTTARGET", name)
+	form.Set("__EVENTARGUMENT", "")
+	return c.post(ctx, form, "选择签证类别")
+}
+
+// captchaImage 下载页面上的验证码图片
+func (c *ceacHTTPClient) captchaImage(ctx context.Context, page string) ([]byte, error) {
+	el := utils.FindElement(page, c.sel.Get(SelectorCaptchaImage))
+	if el == nil || el.Attrs["src"] == "" {
+		return nil, newCrawlError(ErrSelectorTimeout, nil, "页面缺少 %s", c.sel.Get(SelectorCaptchaImage))
+	}
+	base, err := url.Parse(c.statusURL)
+	if err != nil {
+		return nil, err
+	}
+	src, err := base.Parse(el.Attrs["src"])
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, src.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Referer", c.statusURL)
+	return c.do(ctx, req, "下载验证码图片")
+}
+
+// submit 填写查询条件和验证码并提交表单
+func (c *ceacHTTPClient) submit(ctx context.Context, page string, usStatus *models.QueryUsStatus, captcha string) (string, error) {
+	values := map[string]string{SelectorCaptchaInput: captcha}
+	if usStatus.Category() == models.VisaCategoryIV {
+		values[SelectorCaseNumber] = usStatus.CaseNumber
+	} else {
+		values[SelectorLocation] = usStatus.Location
+		values[SelectorCaseNumber] = usStatus.ApplicationID
+		values[SelectorPassportNumber] = usStatus.PassportNumber
+		values[SelectorSurname] = usStatus.First5LettersOfSurname
+	}
+
+	form := formValues(utils.FormFields(page))
+	form.Set("__EVENTTARGET", "")
+	form.Set("__EVENTARGUMENT", "")
+	for key, value := range values {
+		name, err := c.fieldName(page, key)
+		if err != nil {
+			return "", err
+		}
+		form.Set(name, value)
+	}
+	// 提交按钮是图片按钮，需要带上点击坐标
+	button, err := c.fieldName(page, SelectorSubmitButton)
+	if err != nil {
+		return "", err
+	}
+	form.Set(button+".x", "10")
+	form.Set(button+".y", "10")
+	return c.post(ctx, form, "提交查询表单")
+}
+
+// formValues 将表单字段转换为 url.Values
+func formValues(fields map[string]string) url.Values {
+	form := url.Values{}
+	for name, value := range fields {
+		form.Set(name, value)
+	}
+	return form
+}
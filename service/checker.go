@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/models"
+)
+
+// StatusChecker 查询签证在 CEAC 上的状态
+type StatusChecker interface {
+	CheckStatus(ctx context.Context, query *models.QueryUsStatus) (models.UsStatus, error)
+}
+
+// PassportTracker 查询护照的寄送状态
+type PassportTracker interface {
+	TrackPassport(ctx context.Context, query *models.QueryUsStatus) (models.UsStatus, error)
+}
+
+// CeacStatusChecker 通过 CEAC 网站查询签证状态，是 StatusChecker 的默认实现
+type CeacStatusChecker struct{}
+
+// NewCeacStatusChecker 创建默认的签证状态查询器
+func NewCeacStatusChecker() *CeacStatusChecker {
+	return &CeacStatusChecker{}
+}
+
+// CheckStatus 调用 RunVisaStatusCheck 查询签证状态
+func (c *CeacStatusChecker) CheckStatus(ctx context.Context, query *models.QueryUsStatus) (models.UsStatus, error) {
+	return RunVisaStatusCheck(ctx, query)
+}
+
+// EmailPassportTracker 通过邮件向 ustraveldocs 查询护照状态，是 PassportTracker 的默认实现
+type EmailPassportTracker struct{}
+
+// NewEmailPassportTracker 创建默认的护照状态查询器
+func NewEmailPassportTracker() *EmailPassportTracker {
+	return &EmailPassportTracker{}
+}
+
+// TrackPassport 调用 RunVisaEmailTracking 查询护照状态
+func (t *EmailPassportTracker) TrackPassport(ctx context.Context, query *models.QueryUsStatus) (models.UsStatus, error) {
+	return RunVisaEmailTracking(ctx, query)
+}
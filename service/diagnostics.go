@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/config"
+	"crawler-visa/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 诊断包中的文件名
+const (
+	DiagnosticsScreenshot = "screenshot.png" // 失败时的整页截图（仅 chromedp）
+	DiagnosticsDOM        = "dom.html"       // 失败时的页面 DOM
+	diagnosticsMetaFile   = "bundle.json"
+)
+
+// maxConsoleMessages 每次查询最多保留的控制台消息数
+const maxConsoleMessages = 200
+
+// ErrDiagnosticsNotFound 指定的诊断包不存在或已被清理
+var ErrDiagnosticsNotFound = errors.New("诊断包不存在")
+
+// TraceStep 查询过程中执行的一个步骤
+type TraceStep struct {
+	Attempt    int       `json:"attempt"`
+	Name       string    `json:"name"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// crawlTrace 记录一次查询执行过的步骤和页面控制台输出，失败时写入诊断包
+type crawlTrace struct {
+	mu      sync.Mutex
+	attempt int
+	steps   []TraceStep
+	console []string
+	url     string // 最后访问的页面地址
+	page    string // 最后获取的页面 HTML（http 方式）
+}
+
+type crawlTraceKey struct{}
+
+// withCrawlTrace 将步骤记录器绑定到 ctx，runStep 和 HTTP 请求会自动记录
+func withCrawlTrace(ctx context.Context) (context.Context, *crawlTrace) {
+	trace := &crawlTrace{}
+	return context.WithValue(ctx, crawlTraceKey{}, trace), trace
+}
+
+// crawlTraceFrom 返回 ctx 上的步骤记录器，没有时返回 nil，nil 记录器的方法都是空操作
+func crawlTraceFrom(ctx context.Context) *crawlTrace {
+	trace, _ := ctx.Value(crawlTraceKey{}).(*crawlTrace)
+	return trace
+}
+
+func (t *crawlTrace) setAttempt(attempt int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.attempt = attempt
+}
+
+func (t *crawlTrace) recordStep(name string, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	step := TraceStep{Attempt: t.attempt, Name: name, StartedAt: start, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	t.steps = append(t.steps, step)
+}
+
+func (t *crawlTrace) recordConsole(message string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.console) < maxConsoleMessages {
+		t.console = append(t.console, message)
+	}
+}
+
+func (t *crawlTrace) recordPage(url, page string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.url, t.page = url, page
+}
+
+// listenConsole 收集标签页的 console 输出和未捕获的异常
+func (t *crawlTrace) listenConsole(ctx context.Context) {
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *runtime.EventConsoleAPICalled:
+			args := make([]string, 0, len(ev.Args))
+			for _, arg := range ev.Args {
+				if len(arg.Value) > 0 {
+					args = append(args, string(arg.Value))
+				} else {
+					args = append(args, arg.Description)
+				}
+			}
+			t.recordConsole(fmt.Sprintf("console.%s: %s", ev.Type, strings.Join(args, " ")))
+		case *runtime.EventExceptionThrown:
+			message := ev.ExceptionDetails.Text
+			if ev.ExceptionDetails.Exception != nil {
+				message += " " + ev.ExceptionDetails.Exception.Description
+			}
+			t.recordConsole("exception: " + message)
+		}
+	})
+}
+
+// DiagnosticsBundle 一次查询失败时保存的现场信息，用于快速定位选择器失效等问题
+type DiagnosticsBundle struct {
+	ID            string           `json:"id"`
+	ApplicationID string           `json:"application_id"`
+	Attempt       int              `json:"attempt"`
+	Backend       string           `json:"backend"`
+	Error         string           `json:"error"`
+	ErrorCode     string           `json:"error_code"`
+	SelectorsVer  string           `json:"selectors_version"`
+	URL           string           `json:"url"`
+	Steps         []TraceStep      `json:"steps"`
+	Console       []string         `json:"console"`
+	Files         map[string]int64 `json:"files"`
+	CapturedAt    time.Time        `json:"captured_at"`
+}
+
+// DiagnosticsStore 将诊断包保存在 <dir>/<诊断包 ID>/ 下，只保留最近 maxBundles 个
+type DiagnosticsStore struct {
+	mu         sync.Mutex
+	dir        string
+	maxBundles int
+}
+
+// NewDiagnosticsStore 创建诊断包存储
+func NewDiagnosticsStore(dir string, maxBundles int) *DiagnosticsStore {
+	return &DiagnosticsStore{dir: dir, maxBundles: maxBundles}
+}
+
+var (
+	diagnosticsOnce  sync.Once
+	diagnosticsStore *DiagnosticsStore
+)
+
+// DefaultDiagnosticsStore 返回按 DIAGNOSTICS_DIR（默认 diagnostics）和 DIAGNOSTICS_MAX_BUNDLES（默认 200）配置的存储
+func DefaultDiagnosticsStore() *DiagnosticsStore {
+	diagnosticsOnce.Do(func() {
+		diagnosticsStore = NewDiagnosticsStore(
+			config.GetEnv("DIAGNOSTICS_DIR", "diagnostics"),
+			config.GetEnvInt("DIAGNOSTICS_MAX_BUNDLES", 200),
+		)
+	})
+	return diagnosticsStore
+}
+
+// Save 保存诊断包，诊断包 ID 由时间、申请号和尝试次数组成
+func (s *DiagnosticsStore) Save(bundle *DiagnosticsBundle, files map[string][]byte) error {
+	if !safeNamePattern.MatchString(bundle.ApplicationID) {
+		return fmt.Errorf("申请号 %q 不能作为诊断包名称", bundle.ApplicationID)
+	}
+	bundle.ID = fmt.Sprintf("%s-%s-attempt%d", newCheckID(bundle.CapturedAt), bundle.ApplicationID, bundle.Attempt)
+	bundle.Files = make(map[string]int64)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.dir, bundle.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for name, data := range files {
+		if len(data) == 0 {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return err
+		}
+		bundle.Files[name] = int64(len(data))
+	}
+	meta, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, diagnosticsMetaFile), meta, 0o644); err != nil {
+		return err
+	}
+	return s.prune()
+}
+
+// List 返回最近的诊断包，最新的在前；applicationID 不为空时只返回该申请的诊断包
+func (s *DiagnosticsStore) List(applicationID string, limit int) ([]DiagnosticsBundle, error) {
+	names, err := s.bundleNames()
+	if err != nil {
+		return nil, err
+	}
+	bundles := make([]DiagnosticsBundle, 0)
+	for i := len(names) - 1; i >= 0; i-- {
+		if limit > 0 && len(bundles) >= limit {
+			break
+		}
+		var bundle DiagnosticsBundle
+		data, err := os.ReadFile(filepath.Join(s.dir, names[i], diagnosticsMetaFile))
+		if err != nil {
+			continue // 正在写入或已被清理
+		}
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			log.Printf("读取诊断包 %s 失败: %v", names[i], err)
+			continue
+		}
+		if applicationID != "" && bundle.ApplicationID != applicationID {
+			continue
+		}
+		bundles = append(bundles, bundle)
+	}
+	return bundles, nil
+}
+
+// Path 返回诊断包中文件在磁盘上的路径
+func (s *DiagnosticsStore) Path(id, name string) (string, error) {
+	if !safeNamePattern.MatchString(id) || !safeNamePattern.MatchString(name) {
+		return "", ErrDiagnosticsNotFound
+	}
+	path := filepath.Join(s.dir, id, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrDiagnosticsNotFound
+	}
+	return path, nil
+}
+
+// bundleNames 按时间先后返回所有诊断包目录名
+func (s *DiagnosticsStore) bundleNames() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// prune 删除超出数量上限的最旧诊断包
+func (s *DiagnosticsStore) prune() error {
+	if s.maxBundles <= 0 {
+		return nil
+	}
+	names, err := s.bundleNames()
+	if err != nil {
+		return err
+	}
+	for len(names) > s.maxBundles {
+		if err := os.RemoveAll(filepath.Join(s.dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// saveDiagnostics 保存一次失败的诊断包。chromedp 方式会在标签页仍可用时截取截图和 DOM，
+// 查询已超时或取消时只保存步骤记录。保存失败只记录日志。DIAGNOSTICS_ENABLED=false 时不保存。
+func saveDiagnostics(ctx context.Context, usStatus *models.QueryUsStatus, backend string, sel *SelectorSet, crawlErr error) {
+	trace := crawlTraceFrom(ctx)
+	if trace == nil || crawlErr == nil || !config.GetEnvBool("DIAGNOSTICS_ENABLED", true) {
+		return
+	}
+	if errors.Is(crawlErr, ErrInvalidQuery) || errors.Is(crawlErr, ErrCaptchaRejected) {
+		return // 参数错误与页面无关，验证码识别错误是正常现象，都不需要诊断
+	}
+
+	files := make(map[string][]byte)
+	if backend == BackendChromedp && ctx.Err() == nil {
+		var screenshot []byte
+		var dom, url string
+		captureCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := chromedp.Run(captureCtx,
+			chromedp.Location(&url),
+			chromedp.Evaluate(`document.documentElement ? document.documentElement.outerHTML : ""`, &dom),
+			chromedp.FullScreenshot(&screenshot, 100),
+		)
+		cancel()
+		if err != nil {
+			log.Printf("截取诊断信息失败: %v", err)
+		}
+		trace.recordPage(url, dom)
+		files[DiagnosticsScreenshot] = screenshot
+	}
+
+	trace.mu.Lock()
+	code, _ := ErrorCode(crawlErr)
+	bundle := &DiagnosticsBundle{
+		ApplicationID: usStatus.ID(),
+		Attempt:       trace.attempt,
+		Backend:       backend,
+		Error:         crawlErr.Error(),
+		ErrorCode:     code,
+		URL:           trace.url,
+		Steps:         append([]TraceStep(nil), trace.steps...),
+		Console:       append([]string(nil), trace.console...),
+		CapturedAt:    time.Now(),
+	}
+	files[DiagnosticsDOM] = []byte(trace.page)
+	trace.mu.Unlock()
+	if sel != nil {
+		bundle.SelectorsVer = sel.Version
+	}
+
+	if err := DefaultDiagnosticsStore().Save(bundle, files); err != nil {
+		log.Printf("保存诊断包失败: %v", err)
+		return
+	}
+	log.Printf("已保存诊断包 %s", bundle.ID)
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/utils"
+	"errors"
+	"fmt"
+	"github.com/chromedp/chromedp"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// 查询失败的错误类别，调用方使用 errors.Is 判断
+var (
+	ErrInvalidQuery             = errors.New("查询参数不完整")
+	ErrCaptchaRejected          = errors.New("验证码被 CEAC 拒绝")
+	ErrCaptchaSolverUnavailable = errors.New("验证码识别服务不可用")
+	ErrApplicationNotFound      = errors.New("申请记录不存在或信息不匹配")
+	ErrCeacMaintenance          = errors.New("CEAC 网站维护中")
+	ErrSelectorTimeout          = errors.New("等待页面元素超时")
+	ErrBrowserCrashed           = errors.New("浏览器已崩溃或断开连接")
+	ErrCrawlFailed              = errors.New("签证状态查询失败")
+	ErrUnrecognizedPage         = errors.New("无法识别的 CEAC 页面提示")
+	ErrCheckTimeout             = errors.New("查询超过整体时限")
+	ErrCheckCanceled            = errors.New("查询已被调用方取消")
+	ErrMailFailed               = errors.New("护照查询邮件收发失败")
+	ErrPassportReplyTimeout     = errors.New("等待护照状态回复邮件超时")
+)
+
+// StatusClientClosedRequest 调用方在查询完成前断开连接时使用的状态码（沿用 nginx 的约定）
+const StatusClientClosedRequest = 499
+
+// CrawlAction 定时任务遇到错误时应采取的处理方式
+type CrawlAction int
+
+const (
+	ActionRetry CrawlAction = iota // 稍后重试当前申请
+	ActionSkip                     // 跳过当前申请，继续处理下一个
+	ActionAlert                    // 通知管理员并停止本轮任务。网站维护时立即停止，其他告警在多个申请上重复出现时停止
+)
+
+// crawlErrorInfo 错误类别对应的接口错误码、HTTP 状态码和定时任务处理方式
+type crawlErrorInfo struct {
+	code   string
+	status int
+	action CrawlAction
+}
+
+var crawlErrorInfos = []struct {
+	kind error
+	info crawlErrorInfo
+}{
+	{ErrInvalidQuery, crawlErrorInfo{"INVALID_QUERY", http.StatusBadRequest, ActionSkip}},
+	{ErrCaptchaRejected, crawlErrorInfo{"CAPTCHA_REJECTED", http.StatusBadGateway, ActionRetry}},
+	{ErrCaptchaSolverUnavailable, crawlErrorInfo{"CAPTCHA_SOLVER_UNAVAILABLE", http.StatusServiceUnavailable, ActionAlert}},
+	{ErrApplicationNotFound, crawlErrorInfo{"APPLICATION_NOT_FOUND", http.StatusNotFound, ActionSkip}},
+	{ErrCeacMaintenance, crawlErrorInfo{"CEAC_MAINTENANCE", http.StatusServiceUnavailable, ActionAlert}},
+	{ErrSelectorTimeout, crawlErrorInfo{"SELECTOR_TIMEOUT", http.StatusGatewayTimeout, ActionRetry}},
+	{ErrBrowserCrashed, crawlErrorInfo{"BROWSER_CRASHED", http.StatusInternalServerError, ActionRetry}},
+	{ErrCrawlFailed, crawlErrorInfo{"CRAWL_FAILED", http.StatusBadGateway, ActionSkip}},
+	{ErrUnrecognizedPage, crawlErrorInfo{"UNRECOGNIZED_PAGE", http.StatusBadGateway, ActionRetry}},
+	{ErrCheckTimeout, crawlErrorInfo{"CHECK_TIMEOUT", http.StatusGatewayTimeout, ActionRetry}},
+	{ErrCheckCanceled, crawlErrorInfo{"CHECK_CANCELED", StatusClientClosedRequest, ActionSkip}},
+	{ErrMailFailed, crawlErrorInfo{"MAIL_FAILED", http.StatusBadGateway, ActionSkip}},
+	{ErrPassportReplyTimeout, crawlErrorInfo{"PASSPORT_REPLY_TIMEOUT", http.StatusGatewayTimeout, ActionSkip}},
+}
+
+var unknownErrorInfo = crawlErrorInfo{"INTERNAL_ERROR", http.StatusInternalServerError, ActionSkip}
+
+// CrawlError 描述一次查询失败，Kind 为上面定义的错误类别之一
+type CrawlError struct {
+	Kind   error  // 错误类别
+	Detail string // CEAC 页面上的提示信息或补充说明
+	Cause  error  // 底层错误，可能为空
+}
+
+func (e *CrawlError) Error() string {
+	msg := e.Kind.Error()
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Unwrap 同时暴露错误类别和底层错误，便于 errors.Is 判断
+func (e *CrawlError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Cause}
+}
+
+// newCrawlError 创建指定类别的查询错误
+func newCrawlError(kind error, cause error, format string, args ...interface{}) *CrawlError {
+	return &CrawlError{Kind: kind, Detail: fmt.Sprintf(format, args...), Cause: cause}
+}
+
+// lookupErrorInfo 查找错误类别对应的信息。优先使用最外层 CrawlError 的类别：
+// 例如整体超时的 ErrCheckTimeout 包裹了页面操作被中断时的 ErrBrowserCrashed，应按超时处理。
+func lookupErrorInfo(err error) crawlErrorInfo {
+	var crawlErr *CrawlError
+	if errors.As(err, &crawlErr) {
+		for _, item := range crawlErrorInfos {
+			if crawlErr.Kind == item.kind {
+				return item.info
+			}
+		}
+	}
+	for _, item := range crawlErrorInfos {
+		if errors.Is(err, item.kind) {
+			return item.info
+		}
+	}
+	return unknownErrorInfo
+}
+
+// ErrorCode 返回错误对应的稳定接口错误码和 HTTP 状态码
+func ErrorCode(err error) (string, int) {
+	info := lookupErrorInfo(err)
+	return info.code, info.status
+}
+
+// ErrorAction 返回定时任务遇到该错误时应采取的处理方式
+func ErrorAction(err error) CrawlAction {
+	return lookupErrorInfo(err).action
+}
+
+// contextError 根据整体上下文结束的原因返回超时或取消错误
+func contextError(ctx context.Context, cause error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &CrawlError{Kind: ErrCheckTimeout, Cause: cause}
+	}
+	return &CrawlError{Kind: ErrCheckCanceled, Cause: cause}
+}
+
+// classifyBrowserError 将 chromedp 返回的错误归类为超时、浏览器崩溃或一般失败
+func classifyBrowserError(ctx context.Context, err error, step string) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return newCrawlError(ErrSelectorTimeout, err, "%s", step)
+	}
+	if c := chromedp.FromContext(ctx); c != nil && c.Browser != nil {
+		select {
+		case <-c.Browser.LostConnection:
+			return newCrawlError(ErrBrowserCrashed, err, "%s", step)
+		default:
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return newCrawlError(ErrBrowserCrashed, err, "%s", step)
+	}
+	return newCrawlError(ErrCrawlFailed, err, "%s", step)
+}
+
+// ceacNotFoundMessage CEAC 在申请信息不匹配时 lblError 显示的提示
+const ceacNotFoundMessage = "your search did not return any data"
+
+// classifyPageError 根据 CEAC 提交后 lblError 中的提示区分验证码错误、网站维护和申请信息错误。
+// 只有提示与 CEAC 的“查无数据”提示一致时才认为申请不存在，其他无法识别的提示按可重试错误处理，
+// 避免把页面改版或临时故障当成申请信息错误而触发领区探测
+func classifyPageError(message string) error {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "code") && (strings.Contains(lower, "captcha") || strings.Contains(lower, "displayed")):
+		return newCrawlError(ErrCaptchaRejected, nil, "%s", strings.TrimSpace(message))
+	case strings.Contains(lower, "maintenance") || strings.Contains(lower, "unavailable"):
+		return newCrawlError(ErrCeacMaintenance, nil, "%s", strings.TrimSpace(message))
+	case strings.Contains(lower, ceacNotFoundMessage):
+		return newCrawlError(ErrApplicationNotFound, nil, "%s", strings.TrimSpace(message))
+	default:
+		return newCrawlError(ErrUnrecognizedPage, nil, "%s", strings.TrimSpace(message))
+	}
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// isMaintenancePage 判断页面是否为 CEAC 的维护页面，page 为页面 HTML。依次检查：
+//  1. 维护提示区域（maintenance_notice 选择器，尚未用真实的维护页面验证过）；
+//  2. 页面标题中包含 maintenance 或 unavailable；
+//  3. 页面上没有查询表单（找不到验证码图片），且正文中包含 maintenance 或 unavailable。
+//
+// HTTP 方式还会把 503 响应直接视为维护，见 ceacHTTPClient.do
+func isMaintenancePage(page string, sel *SelectorSet) bool {
+	selector := sel.Get(SelectorMaintenance)
+	if selector == "" {
+		selector = defaultMaintenanceSelector
+	}
+	if utils.FindElement(page, selector) != nil {
+		return true
+	}
+	if match := titlePattern.FindStringSubmatch(page); match != nil && mentionsMaintenance(match[1]) {
+		return true
+	}
+	if utils.FindElement(page, sel.Get(SelectorCaptchaImage)) != nil {
+		return false // 查询表单正常显示，正文中的维护字样只是公告
+	}
+	return mentionsMaintenance(utils.HTMLToText(page))
+}
+
+func mentionsMaintenance(text string) bool {
+	lower := strings.ToLower(text)
+	return strings.Contains(lower, "maintenance") || strings.Contains(lower, "unavailable")
+}
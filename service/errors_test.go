@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestErrorCode(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	tests := []struct {
+		name   string
+		err    error
+		code   string
+		status int
+		action CrawlAction
+	}{
+		{
+			name:   "调用方取消时页面操作被中断",
+			err:    contextError(canceled, classifyBrowserError(canceled, context.Canceled, "打开查询页面")),
+			code:   "CHECK_CANCELED",
+			status: StatusClientClosedRequest,
+			action: ActionSkip,
+		},
+		{
+			name:   "整体超时时页面操作被中断",
+			err:    contextError(expired, classifyBrowserError(expired, context.Canceled, "打开查询页面")),
+			code:   "CHECK_TIMEOUT",
+			status: http.StatusGatewayTimeout,
+			action: ActionRetry,
+		},
+		{
+			name:   "重试次数用完后包裹的错误",
+			err:    fmt.Errorf("验证码识别失败超过最大尝试次数 3 次: %w", newCrawlError(ErrCaptchaRejected, nil, "code")),
+			code:   "CAPTCHA_REJECTED",
+			status: http.StatusBadGateway,
+			action: ActionRetry,
+		},
+		{
+			name:   "没有查到申请时保留最后一次的原因",
+			err:    newCrawlError(ErrApplicationNotFound, newCrawlError(ErrCaptchaRejected, nil, "code"), "已尝试领区"),
+			code:   "APPLICATION_NOT_FOUND",
+			status: http.StatusNotFound,
+			action: ActionSkip,
+		},
+		{
+			name:   "浏览器崩溃",
+			err:    newCrawlError(ErrBrowserCrashed, context.Canceled, "打开查询页面"),
+			code:   "BROWSER_CRASHED",
+			status: http.StatusInternalServerError,
+			action: ActionRetry,
+		},
+		{
+			name:   "未分类的错误",
+			err:    errors.New("unknown"),
+			code:   "INTERNAL_ERROR",
+			status: http.StatusInternalServerError,
+			action: ActionSkip,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, status := ErrorCode(tt.err)
+			if code != tt.code || status != tt.status {
+				t.Errorf("ErrorCode() = %s %d, want %s %d", code, status, tt.code, tt.status)
+			}
+			if action := ErrorAction(tt.err); action != tt.action {
+				t.Errorf("ErrorAction() = %d, want %d", action, tt.action)
+			}
+		})
+	}
+}
+
+func TestIsMaintenancePage(t *testing.T) {
+	sel := CurrentSelectors()
+	tests := []struct {
+		name string
+		page string
+		want bool
+	}{
+		{"仿真站点维护页面", `<div class="maintenance"><h1>Consular Electronic Application Center</h1><p>temporarily unavailable</p></div>`, true},
+		{"标题提示维护", `<html><head><title>Service Unavailable</title></head><body><h2>Please try again later.</h2></body></html>`, true},
+		{"没有表单的维护提示", `<html><head><title>CEAC</title></head><body><p>The system is down for maintenance.</p></body></html>`, true},
+		{"表单正常显示时的维护公告", `<html><head><title>CEAC</title></head><body><form><p>Scheduled maintenance notice: the site will be unavailable on Sunday.</p>` +
+			`<img id="c_status_ctl00_contentplaceholder1_defaultcaptcha_CaptchaImage" src="captcha.ashx"><input id="Captcha"></form></body></html>`, false},
+		{"普通页面", `<html><head><title>CEAC</title></head><body><form><img id="c_status_ctl00_contentplaceholder1_defaultcaptcha_CaptchaImage"></form></body></html>`, false},
+	}
+	for _, tt := range tests {
+		if got := isMaintenancePage(tt.page, sel); got != tt.want {
+			t.Errorf("%s: isMaintenancePage() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyPageError(t *testing.T) {
+	tests := []struct {
+		message string
+		kind    error
+	}{
+		{"The code entered does not match the code displayed on the page.", ErrCaptchaRejected},
+		{"Your search did not return any data.", ErrApplicationNotFound},
+		{"The system is temporarily unavailable due to maintenance.", ErrCeacMaintenance},
+		{"An unexpected error has occurred.", ErrUnrecognizedPage},
+	}
+	for _, tt := range tests {
+		err := classifyPageError(tt.message)
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("classifyPageError(%q) = %v, want %v", tt.message, err, tt.kind)
+		}
+	}
+	if action := ErrorAction(classifyPageError("An unexpected error has occurred.")); action != ActionRetry {
+		t.Errorf("unrecognized page error action = %d, want ActionRetry", action)
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"crawler-visa/config"
+	"crawler-visa/models"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 证据文件名
+const (
+	EvidenceScreenshot = "screenshot.jpg" // 结果页整页截图（仅 chromedp）
+	EvidenceResultHTML = "result.html"    // 结果面板的 HTML（http 方式为整个结果页）
+	evidenceMetaFile   = "meta.json"
+)
+
+// ErrEvidenceNotFound 指定的证据不存在或已过期清理
+var ErrEvidenceNotFound = errors.New("查询证据不存在")
+
+// safeNamePattern 申请号、检查 ID 和文件名只允许这些字符，防止路径穿越
+var safeNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Evidence 一次成功查询保存的证据，客户对通知有异议时用于核对当时 CEAC 页面的内容
+type Evidence struct {
+	CheckID       string           `json:"check_id"`       // 检查 ID，同时写入 UsStatus.EvidenceID
+	ApplicationID string           `json:"application_id"` // NIV 为 AA 申请号，IV 为案件号
+	Backend       string           `json:"backend"`        // 查询方式 chromedp / http
+	Status        models.UsStatus  `json:"status"`         // 本次查询解析出的结果
+	Files         map[string]int64 `json:"files"`          // 保存的文件及大小
+	Skipped       []string         `json:"skipped,omitempty"`
+	CapturedAt    time.Time        `json:"captured_at"`
+}
+
+// EvidenceArchive 将查询证据按 <dir>/<申请号>/<检查 ID>/ 保存在本地磁盘，
+// 单次证据超过 maxBytes 的文件不保存，超过 retention 的证据在保存新证据时清理
+type EvidenceArchive struct {
+	mu        sync.Mutex
+	dir       string
+	maxBytes  int64
+	retention time.Duration
+}
+
+// NewEvidenceArchive 创建证据存档
+func NewEvidenceArchive(dir string, maxBytes int64, retention time.Duration) *EvidenceArchive {
+	return &EvidenceArchive{dir: dir, maxBytes: maxBytes, retention: retention}
+}
+
+var (
+	evidenceOnce    sync.Once
+	evidenceArchive *EvidenceArchive
+)
+
+// DefaultEvidenceArchive 返回按 EVIDENCE_DIR（默认 evidence）、EVIDENCE_MAX_BYTES（默认 5MB）
+// 和 EVIDENCE_RETENTION（默认 90 天）配置的证据存档
+func DefaultEvidenceArchive() *EvidenceArchive {
+	evidenceOnce.Do(func() {
+		evidenceArchive = NewEvidenceArchive(
+			config.GetEnv("EVIDENCE_DIR", "evidence"),
+			int64(config.GetEnvInt("EVIDENCE_MAX_BYTES", 5<<20)),
+			config.GetEnvDuration("EVIDENCE_RETENTION", 90*24*time.Hour),
+		)
+	})
+	return evidenceArchive
+}
+
+// newCheckID 生成按时间排序的检查 ID
+func newCheckID(now time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return now.Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// Save 保存一次查询的证据文件，files 的键为文件名
+func (a *EvidenceArchive) Save(applicationID, backend string, status models.UsStatus, files map[string][]byte) (Evidence, error) {
+	if !safeNamePattern.MatchString(applicationID) {
+		return Evidence{}, fmt.Errorf("申请号 %q 不能作为证据目录名", applicationID)
+	}
+	now := time.Now()
+	evidence := Evidence{
+		CheckID:       newCheckID(now),
+		ApplicationID: applicationID,
+		Backend:       backend,
+		Status:        status,
+		Files:         make(map[string]int64),
+		CapturedAt:    now,
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dir := filepath.Join(a.dir, applicationID, evidence.CheckID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Evidence{}, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var total int64
+	for _, name := range names {
+		data := files[name]
+		if len(data) == 0 {
+			continue
+		}
+		if a.maxBytes > 0 && total+int64(len(data)) > a.maxBytes {
+			log.Printf("查询证据 %s/%s 超过大小限制 %d 字节，不保存 %s", applicationID, evidence.CheckID, a.maxBytes, name)
+			evidence.Skipped = append(evidence.Skipped, name)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return Evidence{}, err
+		}
+		evidence.Files[name] = int64(len(data))
+		total += int64(len(data))
+	}
+
+	meta, err := json.MarshalIndent(evidence, "", "  ")
+	if err != nil {
+		return Evidence{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, evidenceMetaFile), meta, 0o644); err != nil {
+		return Evidence{}, err
+	}
+
+	if removed, err := a.prune(now); err != nil {
+		log.Printf("清理过期查询证据失败: %v", err)
+	} else if removed > 0 {
+		log.Printf("已清理 %d 份过期查询证据", removed)
+	}
+	return evidence, nil
+}
+
+// List 返回申请的全部证据，最新的在前
+func (a *EvidenceArchive) List(applicationID string) ([]Evidence, error) {
+	if !safeNamePattern.MatchString(applicationID) {
+		return nil, ErrEvidenceNotFound
+	}
+	entries, err := os.ReadDir(filepath.Join(a.dir, applicationID))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Evidence{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	evidences := make([]Evidence, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].IsDir() {
+			continue
+		}
+		evidence, err := a.readMeta(applicationID, entries[i].Name())
+		if err != nil {
+			log.Printf("读取查询证据 %s/%s 失败: %v", applicationID, entries[i].Name(), err)
+			continue
+		}
+		evidences = append(evidences, evidence)
+	}
+	return evidences, nil
+}
+
+// Path 返回证据文件在磁盘上的路径
+func (a *EvidenceArchive) Path(applicationID, checkID, name string) (string, error) {
+	for _, part := range []string{applicationID, checkID, name} {
+		if !safeNamePattern.MatchString(part) {
+			return "", ErrEvidenceNotFound
+		}
+	}
+	path := filepath.Join(a.dir, applicationID, checkID, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrEvidenceNotFound
+	}
+	return path, nil
+}
+
+// Prune 删除早于 retention 的证据，返回删除的数量
+func (a *EvidenceArchive) Prune(now time.Time) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.prune(now)
+}
+
+func (a *EvidenceArchive) prune(now time.Time) (int, error) {
+	if a.retention <= 0 {
+		return 0, nil
+	}
+	applications, err := os.ReadDir(a.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	cutoff := now.Add(-a.retention).Format("20060102T150405")
+	removed := 0
+	for _, application := range applications {
+		if !application.IsDir() {
+			continue
+		}
+		appDir := filepath.Join(a.dir, application.Name())
+		checks, err := os.ReadDir(appDir)
+		if err != nil {
+			return removed, err
+		}
+		kept := 0
+		for _, check := range checks {
+			// 检查 ID 以时间开头，直接按字符串比较
+			if check.Name() >= cutoff {
+				kept++
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(appDir, check.Name())); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if kept == 0 {
+			os.Remove(appDir)
+		}
+	}
+	return removed, nil
+}
+
+func (a *EvidenceArchive) readMeta(applicationID, checkID string) (Evidence, error) {
+	var evidence Evidence
+	data, err := os.ReadFile(filepath.Join(a.dir, applicationID, checkID, evidenceMetaFile))
+	if err != nil {
+		return evidence, err
+	}
+	err = json.Unmarshal(data, &evidence)
+	return evidence, err
+}
+
+// archiveEvidence 保存查询证据并把检查 ID 写回结果，保存失败只记录日志，不影响查询结果。
+// EVIDENCE_ENABLED=false 时不保存。
+func archiveEvidence(usStatus *models.QueryUsStatus, backend string, result *models.UsStatus, files map[string][]byte) {
+	if !config.GetEnvBool("EVIDENCE_ENABLED", true) {
+		return
+	}
+	evidence, err := DefaultEvidenceArchive().Save(usStatus.ID(), backend, *result, files)
+	if err != nil {
+		log.Printf("保存查询证据失败: %v", err)
+		return
+	}
+	result.EvidenceID = evidence.CheckID
+	log.Printf("已保存查询证据 %s/%s", evidence.ApplicationID, evidence.CheckID)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/models"
+	"fmt"
+	"sync"
+)
+
+// FakeStatusChecker 是内存中的假查询器，同时实现 StatusChecker 和 PassportTracker，
+// 按申请标识（QueryUsStatus.ID）返回预设结果，不启动浏览器也不收发邮件，用于测试 HTTP 接口和定时任务。
+type FakeStatusChecker struct {
+	mu        sync.Mutex
+	statuses  map[string]models.UsStatus
+	passports map[string]models.UsStatus
+	errors    map[string]error
+	calls     []string
+}
+
+// NewFakeStatusChecker 创建没有任何预设结果的假查询器
+func NewFakeStatusChecker() *FakeStatusChecker {
+	return &FakeStatusChecker{
+		statuses:  make(map[string]models.UsStatus),
+		passports: make(map[string]models.UsStatus),
+		errors:    make(map[string]error),
+	}
+}
+
+// SetStatus 预设某个申请的签证状态查询结果
+func (f *FakeStatusChecker) SetStatus(id string, status models.UsStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[id] = status
+}
+
+// SetPassport 预设某个申请的护照状态查询结果
+func (f *FakeStatusChecker) SetPassport(id string, status models.UsStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.passports[id] = status
+}
+
+// SetError 预设某个申请查询时返回的错误，签证状态和护照状态查询都会返回该错误
+func (f *FakeStatusChecker) SetError(id string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors[id] = err
+}
+
+// Calls 返回按调用顺序记录的查询，格式为 "status:<id>" 或 "passport:<id>"
+func (f *FakeStatusChecker) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// CheckStatus 返回预设的签证状态，没有预设时返回 APPLICATION_NOT_FOUND
+func (f *FakeStatusChecker) CheckStatus(ctx context.Context, query *models.QueryUsStatus) (models.UsStatus, error) {
+	return f.lookup(ctx, "status", f.statuses, query)
+}
+
+// TrackPassport 返回预设的护照状态，没有预设时返回 APPLICATION_NOT_FOUND
+func (f *FakeStatusChecker) TrackPassport(ctx context.Context, query *models.QueryUsStatus) (models.UsStatus, error) {
+	return f.lookup(ctx, "passport", f.passports, query)
+}
+
+func (f *FakeStatusChecker) lookup(ctx context.Context, kind string, results map[string]models.UsStatus, query *models.QueryUsStatus) (models.UsStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := query.ID()
+	f.calls = append(f.calls, fmt.Sprintf("%s:%s", kind, id))
+	if err := ctx.Err(); err != nil {
+		return models.UsStatus{}, contextError(ctx, err)
+	}
+	if err, ok := f.errors[id]; ok {
+		return models.UsStatus{}, err
+	}
+	result, ok := results[id]
+	if !ok {
+		return models.UsStatus{}, newCrawlError(ErrApplicationNotFound, nil, "%s", id)
+	}
+	return result, nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/config"
+	"crawler-visa/models"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"strings"
+	"time"
+)
+
+// defaultCandidateLocations 中国大陆及香港的领区代码
+var defaultCandidateLocations = []string{"BEJ", "CHE", "GUZ", "SHG", "SNY", "HNK"}
+
+// CandidateLocations 返回自动探测领区时依次尝试的领区代码，由 CEAC_CANDIDATE_LOCATIONS（逗号分隔）配置，
+// 默认为中国大陆各领区及香港
+func CandidateLocations() []string {
+	return config.GetEnvList("CEAC_CANDIDATE_LOCATIONS", defaultCandidateLocations)
+}
+
+// LocationStore 保存探测到的正确领区
+type LocationStore interface {
+	UpdateLocation(ctx context.Context, id, location string) error
+}
+
+// RedisLocationStore 更新 Redis 中 application:status:<ID> 记录的领区，记录不存在时不做任何事
+type RedisLocationStore struct {
+	client *redis.Client
+}
+
+// NewRedisLocationStore 创建基于 Redis 的领区存储
+func NewRedisLocationStore(client *redis.Client) *RedisLocationStore {
+	return &RedisLocationStore{client: client}
+}
+
+const applicationKeyPrefix = "application:status:"
+
+// UpdateLocation 把申请记录中的领区改为 location，保留记录的其他字段和过期时间
+func (s *RedisLocationStore) UpdateLocation(ctx context.Context, id, location string) error {
+	key := applicationKeyPrefix + id
+	result, err := s.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil // 没有保存过的临时查询
+	} else if err != nil {
+		return err
+	}
+	var query models.QueryUsStatus
+	if err := json.Unmarshal([]byte(result), &query); err != nil {
+		return err
+	}
+	query.Location = location
+	marshal, err := json.Marshal(&query)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, key, marshal, redis.KeepTTL).Err()
+}
+
+// LocationDiscoveryChecker 在查询条件开启 AutoLocation 且 CEAC 返回申请信息不匹配时，
+// 依次用候选领区重新查询，查到后把正确的领区写回存储，并通过 UsStatus.MatchedLocation 返回
+type LocationDiscoveryChecker struct {
+	Checker    StatusChecker
+	Candidates []string
+	MaxProbes  int           // 最多尝试的候选领区数量，小于等于 0 时不限制
+	Timeout    time.Duration // 所有候选领区查询的总时限，小于等于 0 时不限制
+	Store      LocationStore // 为 nil 时只返回探测结果，不保存。临时查询不应设置，避免改写已保存的申请
+}
+
+// NewLocationDiscoveryChecker 为 checker 增加领区自动探测。
+// 最多尝试 CEAC_MAX_LOCATION_PROBES 个候选领区（默认 0，尝试全部候选），全部候选查询共用一个 CHECK_TIMEOUT（默认 3 分钟）
+func NewLocationDiscoveryChecker(checker StatusChecker, candidates []string, store LocationStore) *LocationDiscoveryChecker {
+	return &LocationDiscoveryChecker{
+		Checker:    checker,
+		Candidates: candidates,
+		MaxProbes:  config.GetEnvInt("CEAC_MAX_LOCATION_PROBES", 0),
+		Timeout:    config.GetEnvDuration("CHECK_TIMEOUT", 3*time.Minute),
+		Store:      store,
+	}
+}
+
+// CheckStatus 先按填写的领区查询，CEAC 明确提示查无数据时再尝试其他候选领区。
+// 每次探测都要识别一次验证码，因此只有错误本身（最外层类别）就是申请不存在时才探测，
+// 候选领区查询遇到其他错误（超时、维护、无法识别的页面等）时停止探测并返回该错误。
+func (c *LocationDiscoveryChecker) CheckStatus(ctx context.Context, query *models.QueryUsStatus) (models.UsStatus, error) {
+	status, err := c.Checker.CheckStatus(ctx, query)
+	if !isApplicationNotFound(err) || !query.AutoLocation || query.Category() != models.VisaCategoryNIV {
+		return status, err
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	var tried []string
+	if query.Location != "" {
+		tried = append(tried, query.Location)
+	}
+	var skipped []string
+	probes := 0
+	for _, location := range c.Candidates {
+		if containsFold(tried, location) {
+			continue
+		}
+		if c.MaxProbes > 0 && probes >= c.MaxProbes {
+			skipped = append(skipped, location)
+			continue
+		}
+		if ctx.Err() != nil {
+			return models.UsStatus{}, contextError(ctx, ctx.Err())
+		}
+		probes++
+		probe := *query
+		probe.Location = location
+		log.Printf("申请 %s 在领区 %s 不匹配，尝试领区 %s", query.ID(), query.Location, location)
+		status, probeErr := c.Checker.CheckStatus(ctx, &probe)
+		if probeErr == nil {
+			log.Printf("申请 %s 的正确领区为 %s", query.ID(), location)
+			status.MatchedLocation = location
+			if c.Store != nil {
+				if err := c.Store.UpdateLocation(ctx, query.ID(), location); err != nil {
+					log.Printf("保存申请 %s 的领区失败: %v", query.ID(), err)
+				}
+			}
+			return status, nil
+		}
+		if !isApplicationNotFound(probeErr) {
+			return models.UsStatus{}, probeErr
+		}
+		tried = append(tried, location)
+	}
+	if len(skipped) > 0 {
+		return models.UsStatus{}, newCrawlError(ErrApplicationNotFound, err, "已尝试领区 %s，超过 CEAC_MAX_LOCATION_PROBES 未尝试领区 %s",
+			strings.Join(tried, "、"), strings.Join(skipped, "、"))
+	}
+	return models.UsStatus{}, newCrawlError(ErrApplicationNotFound, err, "已尝试领区 %s", strings.Join(tried, "、"))
+}
+
+// isApplicationNotFound 判断错误是否就是申请不存在，被超时等其他错误包裹时不算
+func isApplicationNotFound(err error) bool {
+	var crawlErr *CrawlError
+	return errors.As(err, &crawlErr) && crawlErr.Kind == ErrApplicationNotFound
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/models"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// locationChecker 只在 location 领区查得到申请，记录每次查询的领区
+type locationChecker struct {
+	location string
+	mu       sync.Mutex
+	tried    []string
+}
+
+func (c *locationChecker) CheckStatus(ctx context.Context, query *models.QueryUsStatus) (models.UsStatus, error) {
+	c.mu.Lock()
+	c.tried = append(c.tried, query.Location)
+	c.mu.Unlock()
+	if query.Location != c.location {
+		return models.UsStatus{}, newCrawlError(ErrApplicationNotFound, nil, "%s", query.Location)
+	}
+	return models.UsStatus{Status: "Issued"}, nil
+}
+
+// unrecognizedChecker 查询后总是返回无法识别的页面提示，提示中包裹了申请不存在
+type unrecognizedChecker struct {
+	*locationChecker
+}
+
+func (c unrecognizedChecker) CheckStatus(ctx context.Context, query *models.QueryUsStatus) (models.UsStatus, error) {
+	_, err := c.locationChecker.CheckStatus(ctx, query)
+	return models.UsStatus{}, newCrawlError(ErrUnrecognizedPage, err, "unexpected page")
+}
+
+// locationRecorder 记录写回的领区
+type locationRecorder map[string]string
+
+func (r locationRecorder) UpdateLocation(ctx context.Context, id, location string) error {
+	r[id] = location
+	return nil
+}
+
+func TestLocationDiscovery(t *testing.T) {
+	candidates := []string{"BEJ", "GUZ", "SHG", "CHE", "HNK"}
+	query := models.QueryUsStatus{Location: "GUZ", ApplicationID: "AA00000001", AutoLocation: true}
+
+	t.Run("探测到后写回", func(t *testing.T) {
+		inner := &locationChecker{location: "SHG"}
+		store := locationRecorder{}
+		c := &LocationDiscoveryChecker{Checker: inner, Candidates: candidates, MaxProbes: 3, Store: store}
+		q := query
+		status, err := c.CheckStatus(context.Background(), &q)
+		if err != nil || status.MatchedLocation != "SHG" {
+			t.Fatalf("CheckStatus() = %+v, %v, want SHG", status, err)
+		}
+		if store["AA00000001"] != "SHG" {
+			t.Errorf("store = %v, want SHG saved", store)
+		}
+		if got := strings.Join(inner.tried, ","); got != "GUZ,BEJ,SHG" {
+			t.Errorf("tried = %s, want GUZ,BEJ,SHG", got)
+		}
+	})
+
+	t.Run("最多尝试 MaxProbes 个领区", func(t *testing.T) {
+		inner := &locationChecker{location: "HNK"}
+		c := &LocationDiscoveryChecker{Checker: inner, Candidates: candidates, MaxProbes: 2}
+		q := query
+		_, err := c.CheckStatus(context.Background(), &q)
+		if !errors.Is(err, ErrApplicationNotFound) || !strings.Contains(err.Error(), "已尝试领区 GUZ、BEJ、SHG") ||
+			!strings.Contains(err.Error(), "未尝试领区 CHE、HNK") {
+			t.Errorf("error = %v, want not found after GUZ、BEJ、SHG with CHE、HNK skipped", err)
+		}
+		if len(inner.tried) != 3 {
+			t.Errorf("tried = %v, want 3 checks", inner.tried)
+		}
+	})
+
+	t.Run("没有填写领区", func(t *testing.T) {
+		c := &LocationDiscoveryChecker{Checker: &locationChecker{location: "HNK"}, Candidates: []string{"BEJ"}}
+		q := query
+		q.Location = ""
+		_, err := c.CheckStatus(context.Background(), &q)
+		if err == nil || !strings.Contains(err.Error(), "已尝试领区 BEJ") || strings.Contains(err.Error(), "、") {
+			t.Errorf("error = %v, want only BEJ listed", err)
+		}
+	})
+
+	t.Run("不是明确的查无数据时不探测", func(t *testing.T) {
+		inner := &locationChecker{location: "SHG"}
+		c := &LocationDiscoveryChecker{Checker: unrecognizedChecker{inner}, Candidates: candidates}
+		q := query
+		if _, err := c.CheckStatus(context.Background(), &q); !errors.Is(err, ErrUnrecognizedPage) {
+			t.Errorf("error = %v, want ErrUnrecognizedPage", err)
+		}
+		if len(inner.tried) != 1 {
+			t.Errorf("tried = %v, want no probes", inner.tried)
+		}
+	})
+
+	t.Run("超过总时限", func(t *testing.T) {
+		inner := &locationChecker{location: "SHG"}
+		c := &LocationDiscoveryChecker{Checker: inner, Candidates: candidates, Timeout: time.Nanosecond}
+		q := query
+		_, err := c.CheckStatus(context.Background(), &q)
+		if !errors.Is(err, ErrCheckTimeout) {
+			t.Errorf("error = %v, want ErrCheckTimeout", err)
+		}
+		if len(inner.tried) != 1 {
+			t.Errorf("tried = %v, want no probes after the deadline", inner.tried)
+		}
+	})
+}
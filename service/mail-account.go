@@ -0,0 +1,447 @@
+package service
+
+import (
+	"crawler-visa/config"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/emersion/go-imap/client"
+	"gopkg.in/gomail.v2"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailSecurity 连接邮件服务器的加密方式
+type MailSecurity string
+
+const (
+	MailSecurityTLS      MailSecurity = "tls"      // 连接建立时即使用 TLS（SMTP 465 / IMAP 993）
+	MailSecurityStartTLS MailSecurity = "starttls" // 明文连接后通过 STARTTLS 升级（SMTP 587 / IMAP 143）
+	MailSecurityNone     MailSecurity = "none"     // 不加密，只用于内网测试
+)
+
+// MailServer 一个 SMTP 或 IMAP 服务器
+type MailServer struct {
+	Host     string       `json:"host"`
+	Port     int          `json:"port"`
+	Security MailSecurity `json:"security"`
+}
+
+func (s MailServer) addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// mailProvider 常用邮箱服务商的服务器预设
+type mailProvider struct {
+	SMTP     MailServer
+	IMAP     MailServer
+	IMAPID   bool   // 登录后需要上报客户端 ID（网易邮箱不上报会拒绝 SELECT）
+	Auth     string // 默认登录方式：password / xoauth2
+	TokenURL string // OAuth2 刷新 token 的地址，%s 为租户
+	Scope    string // OAuth2 刷新时申请的权限
+}
+
+var mailProviders = map[string]mailProvider{
+	"163": {
+		SMTP:   MailServer{"smtp.163.com", 465, MailSecurityTLS},
+		IMAP:   MailServer{"imap.163.com", 993, MailSecurityTLS},
+		IMAPID: true,
+	},
+	"qq": {
+		SMTP: MailServer{"smtp.qq.com", 465, MailSecurityTLS},
+		IMAP: MailServer{"imap.qq.com", 993, MailSecurityTLS},
+	},
+	"exmail": {
+		SMTP: MailServer{"smtp.exmail.qq.com", 465, MailSecurityTLS},
+		IMAP: MailServer{"imap.exmail.qq.com", 993, MailSecurityTLS},
+	},
+	// Google Workspace 和 Microsoft 365 已禁用密码登录，默认使用 XOAUTH2
+	"gmail": {
+		SMTP:     MailServer{"smtp.gmail.com", 465, MailSecurityTLS},
+		IMAP:     MailServer{"imap.gmail.com", 993, MailSecurityTLS},
+		Auth:     mailAuthXOAuth2,
+		TokenURL: "https://oauth2.googleapis.com/token",
+	},
+	"outlook": {
+		SMTP:     MailServer{"smtp.office365.com", 587, MailSecurityStartTLS},
+		IMAP:     MailServer{"outlook.office365.com", 993, MailSecurityTLS},
+		Auth:     mailAuthXOAuth2,
+		TokenURL: "https://login.microsoftonline.com/%s/oauth2/v2.0/token",
+		Scope:    "https://outlook.office.com/IMAP.AccessAsUser.All https://outlook.office.com/SMTP.Send offline_access",
+	},
+	"generic": {}, // 服务器地址需要单独配置
+}
+
+// 邮箱登录方式
+const (
+	mailAuthPassword = "password"
+	mailAuthXOAuth2  = "xoauth2"
+)
+
+// providerFromAddress 根据邮箱域名推断服务商，无法识别时为 generic
+func providerFromAddress(address string) string {
+	switch strings.ToLower(address[strings.LastIndex(address, "@")+1:]) {
+	case "163.com":
+		return "163"
+	case "qq.com", "foxmail.com":
+		return "qq"
+	case "gmail.com", "googlemail.com":
+		return "gmail"
+	case "outlook.com", "hotmail.com", "live.com":
+		return "outlook"
+	}
+	return "generic"
+}
+
+// MailAccount 一个用于发送护照查询邮件并接收回复的邮箱
+type MailAccount struct {
+	Name       string            // 配置中的账号名
+	Username   string            // 登录名，通常就是邮箱地址
+	Password   string            // 密码或客户端授权码，使用 XOAUTH2 时不需要
+	From       string            // 发件地址，默认与 Username 相同
+	Provider   string            // 163 / qq / exmail / gmail / outlook / generic
+	SMTP       MailServer        // 发件服务器
+	IMAP       MailServer        // 收件服务器
+	IMAPID     bool              // 登录后上报客户端 ID
+	DailyQuota int               // 每天最多发送的查询邮件数，0 表示不限制
+	AuthMethod string            // 登录方式：password / xoauth2
+	Auth       MailAuthenticator // 登录实现，为空时使用用户名和密码
+}
+
+// LoadMailAccounts 读取邮箱账号配置。
+// MAIL_ACCOUNTS 为逗号分隔的账号名，每个账号的配置项以 MAIL_<账号名>_ 开头；未配置 MAIL_ACCOUNTS 时
+// 读取以 MAIL_ 开头的单个账号。每个账号的配置项：
+//
+//	USERNAME、PASSWORD、FROM（默认为 USERNAME）
+//	PROVIDER：163 / qq / exmail / gmail / outlook / generic，默认按邮箱域名推断
+//	SMTP_HOST、SMTP_PORT、SMTP_SECURITY（tls / starttls / none），未设置时使用服务商预设
+//	IMAP_HOST、IMAP_PORT、IMAP_SECURITY，同上
+//	IMAP_ID：登录后是否上报客户端 ID，默认使用服务商预设
+//	DAILY_QUOTA：每天最多发送的查询邮件数，默认 0 表示不限制
+//	AUTH：password / xoauth2，gmail 和 outlook 默认 xoauth2，其余默认 password
+//	OAUTH_CLIENT_ID、OAUTH_CLIENT_SECRET：XOAUTH2 使用的 OAuth2 应用
+//	OAUTH_REFRESH_TOKEN 或 OAUTH_REFRESH_TOKEN_FILE：保存的 refresh token，使用文件时刷新后的新 token 会写回文件
+//	OAUTH_TOKEN_URL、OAUTH_SCOPE、OAUTH_TENANT（outlook，默认 common）：未设置时使用服务商预设
+func LoadMailAccounts() ([]*MailAccount, error) {
+	names := config.GetEnvList("MAIL_ACCOUNTS", nil)
+	if len(names) == 0 {
+		if config.GetEnv("MAIL_USERNAME", "") == "" {
+			return nil, nil
+		}
+		account, err := loadMailAccount("default", "MAIL_")
+		if err != nil {
+			return nil, err
+		}
+		return []*MailAccount{account}, nil
+	}
+	var accounts []*MailAccount
+	for _, name := range names {
+		account, err := loadMailAccount(name, "MAIL_"+strings.ToUpper(name)+"_")
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// loadMailAccount 读取以 prefix 开头的一个账号的配置
+func loadMailAccount(name, prefix string) (*MailAccount, error) {
+	account := &MailAccount{
+		Name:       name,
+		Username:   config.GetEnv(prefix+"USERNAME", ""),
+		Password:   config.GetEnv(prefix+"PASSWORD", ""),
+		DailyQuota: config.GetEnvInt(prefix+"DAILY_QUOTA", 0),
+	}
+	if account.Username == "" {
+		return nil, fmt.Errorf("邮箱账号 %s 未配置 %sUSERNAME", name, prefix)
+	}
+	account.From = config.GetEnv(prefix+"FROM", account.Username)
+	account.Provider = strings.ToLower(config.GetEnv(prefix+"PROVIDER", providerFromAddress(account.From)))
+	preset, ok := mailProviders[account.Provider]
+	if !ok {
+		return nil, fmt.Errorf("邮箱账号 %s 的服务商 %s 不支持，可选: 163, qq, exmail, gmail, outlook, generic", name, account.Provider)
+	}
+	account.IMAPID = config.GetEnvBool(prefix+"IMAP_ID", preset.IMAPID)
+	if err := loadMailAuth(account, prefix, preset); err != nil {
+		return nil, fmt.Errorf("邮箱账号 %s: %w", name, err)
+	}
+
+	var err error
+	if account.SMTP, err = loadMailServer(prefix+"SMTP_", preset.SMTP, 465, 587); err != nil {
+		return nil, fmt.Errorf("邮箱账号 %s: %w", name, err)
+	}
+	if account.IMAP, err = loadMailServer(prefix+"IMAP_", preset.IMAP, 993, 143); err != nil {
+		return nil, fmt.Errorf("邮箱账号 %s: %w", name, err)
+	}
+	return account, nil
+}
+
+// loadMailAuth 读取账号的登录方式
+func loadMailAuth(account *MailAccount, prefix string, preset mailProvider) error {
+	defaultAuth := preset.Auth
+	if defaultAuth == "" {
+		defaultAuth = mailAuthPassword
+	}
+	account.AuthMethod = strings.ToLower(config.GetEnv(prefix+"AUTH", defaultAuth))
+	switch account.AuthMethod {
+	case mailAuthPassword:
+		return nil
+	case mailAuthXOAuth2:
+	default:
+		return fmt.Errorf("%sAUTH 只能是 password 或 xoauth2", prefix)
+	}
+
+	tokenURL := preset.TokenURL
+	if strings.Contains(tokenURL, "%s") {
+		tokenURL = fmt.Sprintf(tokenURL, config.GetEnv(prefix+"OAUTH_TENANT", "common"))
+	}
+	tokens, err := NewOAuth2TokenSource(
+		config.GetEnv(prefix+"OAUTH_TOKEN_URL", tokenURL),
+		config.GetEnv(prefix+"OAUTH_CLIENT_ID", ""),
+		config.GetEnv(prefix+"OAUTH_CLIENT_SECRET", ""),
+		config.GetEnv(prefix+"OAUTH_SCOPE", preset.Scope),
+		config.GetEnv(prefix+"OAUTH_REFRESH_TOKEN", ""),
+		config.GetEnv(prefix+"OAUTH_REFRESH_TOKEN_FILE", ""),
+	)
+	if err != nil {
+		return err
+	}
+	account.Auth = NewXOAuth2Auth(tokens)
+	return nil
+}
+
+// authenticator 返回账号的登录实现
+func (a *MailAccount) authenticator() MailAuthenticator {
+	if a.Auth == nil {
+		return passwordAuth{}
+	}
+	return a.Auth
+}
+
+// loadMailServer 读取服务器配置，未设置的项使用预设；端口未设置且预设为空时按加密方式取默认端口
+func loadMailServer(prefix string, preset MailServer, tlsPort, plainPort int) (MailServer, error) {
+	server := MailServer{
+		Host:     config.GetEnv(prefix+"HOST", preset.Host),
+		Security: MailSecurity(strings.ToLower(config.GetEnv(prefix+"SECURITY", string(preset.Security)))),
+	}
+	if server.Host == "" {
+		return server, fmt.Errorf("未配置 %sHOST", prefix)
+	}
+	switch server.Security {
+	case "":
+		server.Security = MailSecurityTLS
+	case MailSecurityTLS, MailSecurityStartTLS, MailSecurityNone:
+	default:
+		return server, fmt.Errorf("%sSECURITY 只能是 tls、starttls 或 none", prefix)
+	}
+	defaultPort := preset.Port
+	if defaultPort == 0 || server.Security != preset.Security {
+		defaultPort = plainPort
+		if server.Security == MailSecurityTLS {
+			defaultPort = tlsPort
+		}
+	}
+	server.Port = config.GetEnvInt(prefix+"PORT", defaultPort)
+	return server, nil
+}
+
+// smtpDialer 返回发送邮件用的 gomail.Dialer。gomail 在非 TLS 连接上只在服务器声明支持时才执行 STARTTLS，
+// 因此 SECURITY=starttls 时用 startTLSAuth 包裹登录方式，连接没有加密时拒绝登录，不会明文发出密码和邮件
+func (a *MailAccount) smtpDialer() *gomail.Dialer {
+	d := gomail.NewDialer(a.SMTP.Host, a.SMTP.Port, a.Username, a.Password)
+	d.SSL = a.SMTP.Security == MailSecurityTLS
+	d.TLSConfig = &tls.Config{ServerName: a.SMTP.Host}
+	d.Auth = a.authenticator().SMTPAuth(a)
+	if a.SMTP.Security == MailSecurityStartTLS {
+		d.Auth = &startTLSAuth{auth: d.Auth, account: a}
+	}
+	return d
+}
+
+// startTLSAuth 要求在 STARTTLS 加密后的连接上登录。未指定登录方式时按服务器支持的方式使用密码登录
+type startTLSAuth struct {
+	auth    smtp.Auth
+	account *MailAccount
+}
+
+func (a *startTLSAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, fmt.Errorf("SMTP 服务器 %s 没有启用 STARTTLS，拒绝明文登录", a.account.SMTP.Host)
+	}
+	if a.auth == nil {
+		a.auth = passwordSMTPAuth(server.Auth, a.account)
+	}
+	return a.auth.Start(server)
+}
+
+func (a *startTLSAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	return a.auth.Next(fromServer, more)
+}
+
+// passwordSMTPAuth 按服务器声明的登录方式选择密码登录，与 gomail 的选择顺序一致：CRAM-MD5、LOGIN（不支持 PLAIN 时）、PLAIN
+func passwordSMTPAuth(mechanisms []string, account *MailAccount) smtp.Auth {
+	supports := func(name string) bool {
+		for _, mechanism := range mechanisms {
+			if strings.EqualFold(mechanism, name) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case supports("CRAM-MD5"):
+		return smtp.CRAMMD5Auth(account.Username, account.Password)
+	case supports("LOGIN") && !supports("PLAIN"):
+		return &smtpLoginAuth{username: account.Username, password: account.Password}
+	default:
+		return smtp.PlainAuth("", account.Username, account.Password, account.SMTP.Host)
+	}
+}
+
+// smtpLoginAuth 实现 AUTH LOGIN，net/smtp 没有提供
+type smtpLoginAuth struct {
+	username string
+	password string
+}
+
+func (a *smtpLoginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a *smtpLoginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("无法识别的 AUTH LOGIN 质询: %s", fromServer)
+}
+
+// dialIMAP 按账号配置的加密方式连接收件服务器，尚未登录
+func (a *MailAccount) dialIMAP(timeout time.Duration) (*client.Client, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	if a.IMAP.Security == MailSecurityTLS {
+		return client.DialWithDialerTLS(dialer, a.IMAP.addr(), &tls.Config{ServerName: a.IMAP.Host})
+	}
+	c, err := client.DialWithDialer(dialer, a.IMAP.addr())
+	if err != nil || a.IMAP.Security != MailSecurityStartTLS {
+		return c, err
+	}
+	if err := c.StartTLS(&tls.Config{ServerName: a.IMAP.Host}); err != nil {
+		c.Logout()
+		return nil, err
+	}
+	return c, nil
+}
+
+// MailAccountStatus 邮箱账号今天的使用情况，用于健康检查
+type MailAccountStatus struct {
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	Provider   string `json:"provider"`
+	AuthMethod string `json:"auth_method"`
+	SentToday  int    `json:"sent_today"`
+	DailyQuota int    `json:"daily_quota"`
+}
+
+// ErrMailQuotaExhausted 所有邮箱账号今天的发送配额都已用完
+var ErrMailQuotaExhausted = errors.New("所有邮箱账号今天的发送配额已用完")
+
+// MailAccountPool 轮流使用多个邮箱账号发送查询邮件，跳过当天配额已用完的账号。
+// 发送计数只保存在内存中，服务重启后重新计算。
+type MailAccountPool struct {
+	mu       sync.Mutex
+	accounts []*MailAccount
+	next     int
+	day      string         // 计数所属的日期
+	sent     map[string]int // 按账号名统计当天已发送数
+}
+
+// NewMailAccountPool 创建邮箱账号池
+func NewMailAccountPool(accounts []*MailAccount) *MailAccountPool {
+	return &MailAccountPool{accounts: accounts, sent: make(map[string]int)}
+}
+
+// Len 返回账号数量
+func (p *MailAccountPool) Len() int {
+	return len(p.accounts)
+}
+
+// resetDay 跨天时清零发送计数，调用方需持有锁
+func (p *MailAccountPool) resetDay(now time.Time) {
+	if day := now.Format(time.DateOnly); day != p.day {
+		p.day = day
+		p.sent = make(map[string]int)
+	}
+}
+
+// Next 轮询选出一个当天还有配额的账号，并占用一次配额
+func (p *MailAccountPool) Next(now time.Time) (*MailAccount, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.accounts) == 0 {
+		return nil, errors.New("未配置邮箱账号（MAIL_ACCOUNTS / MAIL_USERNAME）")
+	}
+	p.resetDay(now)
+	for i := 0; i < len(p.accounts); i++ {
+		account := p.accounts[(p.next+i)%len(p.accounts)]
+		if account.DailyQuota > 0 && p.sent[account.Name] >= account.DailyQuota {
+			continue
+		}
+		p.next = (p.next + i + 1) % len(p.accounts)
+		p.sent[account.Name]++
+		return account, nil
+	}
+	return nil, ErrMailQuotaExhausted
+}
+
+// Snapshot 返回各账号当天的使用情况
+func (p *MailAccountPool) Snapshot() []MailAccountStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resetDay(time.Now())
+	statuses := make([]MailAccountStatus, 0, len(p.accounts))
+	for _, account := range p.accounts {
+		statuses = append(statuses, MailAccountStatus{
+			Name:       account.Name,
+			Address:    account.From,
+			Provider:   account.Provider,
+			AuthMethod: account.AuthMethod,
+			SentToday:  p.sent[account.Name],
+			DailyQuota: account.DailyQuota,
+		})
+	}
+	return statuses
+}
+
+var (
+	mailAccountPoolOnce sync.Once
+	mailAccountPool     *MailAccountPool
+)
+
+// DefaultMailAccountPool 返回护照查询共用的邮箱账号池，第一次使用时按 LoadMailAccounts 读取配置
+func DefaultMailAccountPool() *MailAccountPool {
+	mailAccountPoolOnce.Do(func() {
+		accounts, err := LoadMailAccounts()
+		if err != nil {
+			log.Printf("读取邮箱账号配置失败，护照状态查询不可用: %v", err)
+		}
+		mailAccountPool = NewMailAccountPool(accounts)
+	})
+	return mailAccountPool
+}
+
+// MailAccountStats 返回护照查询使用的各邮箱账号当天的使用情况，不会启动护照查询流水线
+func MailAccountStats() []MailAccountStatus {
+	return DefaultMailAccountPool().Snapshot()
+}
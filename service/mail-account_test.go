@@ -0,0 +1,80 @@
+package service
+
+import (
+	"bufio"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestSendRequiresStartTLS 服务器不支持 STARTTLS 时，SECURITY=starttls 的账号不能明文登录和发信
+func TestSendRequiresStartTLS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	commands := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			commands <- nil
+			return
+		}
+		defer conn.Close()
+		var received []string
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost ESMTP\r\n"))
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			command := strings.ToUpper(strings.Fields(line + " ")[0])
+			received = append(received, command)
+			switch command {
+			case "EHLO":
+				conn.Write([]byte("250-localhost\r\n250 AUTH PLAIN LOGIN\r\n"))
+			case "QUIT":
+				conn.Write([]byte("221 bye\r\n"))
+				commands <- received
+				return
+			default:
+				conn.Write([]byte("250 ok\r\n"))
+			}
+		}
+		commands <- received
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	account := &MailAccount{Name: "test", Username: "test@example.com", Password: "secret", From: "test@example.com",
+		SMTP: MailServer{Host: "127.0.0.1", Port: portNumber, Security: MailSecurityStartTLS}}
+	if err := sendPassportRequest(account, "E00000001"); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("send error = %v, want STARTTLS refusal", err)
+	}
+	for _, command := range <-commands {
+		if command != "EHLO" && command != "QUIT" {
+			t.Errorf("server received %s before STARTTLS", command)
+		}
+	}
+}
+
+func TestPasswordSMTPAuth(t *testing.T) {
+	account := &MailAccount{Username: "test@example.com", Password: "secret", SMTP: MailServer{Host: "smtp.example.com"}}
+	auth := &startTLSAuth{account: account}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"LOGIN"}}); err == nil {
+		t.Error("Start() on an unencrypted connection: error = nil")
+	}
+	mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true, Auth: []string{"LOGIN", "XOAUTH2"}})
+	if err != nil || mechanism != "LOGIN" {
+		t.Fatalf("Start() = %s, %v, want LOGIN", mechanism, err)
+	}
+	for challenge, want := range map[string]string{"Username:": "test@example.com", "Password:": "secret"} {
+		if got, err := auth.Next([]byte(challenge), true); err != nil || string(got) != want {
+			t.Errorf("Next(%s) = %s, %v, want %s", challenge, got, err, want)
+		}
+	}
+}
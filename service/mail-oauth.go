@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/emersion/go-imap/client"
+	"log"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailAuthenticator 邮箱账号的登录方式，按账号配置，为空时使用用户名和密码（授权码）登录
+type MailAuthenticator interface {
+	// SMTPAuth 返回发信时使用的 smtp.Auth，返回 nil 时由 gomail 按服务器支持的方式使用密码登录
+	SMTPAuth(account *MailAccount) smtp.Auth
+	// LoginIMAP 登录收件服务器
+	LoginIMAP(ctx context.Context, c *client.Client, account *MailAccount) error
+}
+
+// passwordAuth 使用用户名和密码（授权码）登录
+type passwordAuth struct{}
+
+func (passwordAuth) SMTPAuth(account *MailAccount) smtp.Auth {
+	return nil
+}
+
+func (passwordAuth) LoginIMAP(ctx context.Context, c *client.Client, account *MailAccount) error {
+	return c.Login(account.Username, account.Password)
+}
+
+// OAuth2TokenSource 使用保存的 refresh token 换取 access token，过期前自动刷新。
+// 服务器返回新的 refresh token 时替换旧的，配置了 tokenFile 时同时写回文件，服务重启后继续使用。
+type OAuth2TokenSource struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scope        string // 刷新时申请的权限，Microsoft 必填，Google 可留空
+
+	mu           sync.Mutex
+	refreshToken string
+	tokenFile    string
+	accessToken  string
+	expiry       time.Time
+	httpClient   *http.Client
+}
+
+// NewOAuth2TokenSource 创建 token 来源。refreshToken 为空时从 tokenFile 读取
+func NewOAuth2TokenSource(tokenURL, clientID, clientSecret, scope, refreshToken, tokenFile string) (*OAuth2TokenSource, error) {
+	if refreshToken == "" && tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 refresh token 文件失败: %w", err)
+		}
+		refreshToken = strings.TrimSpace(string(data))
+	}
+	if tokenURL == "" || clientID == "" || refreshToken == "" {
+		return nil, errors.New("OAuth2 需要配置 token 地址、client id 和 refresh token")
+	}
+	return &OAuth2TokenSource{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scope:        scope,
+		refreshToken: refreshToken,
+		tokenFile:    tokenFile,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// oauth2TokenResponse token 接口的返回结果
+type oauth2TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Token 返回有效的 access token，剩余有效期不足 1 分钟时先刷新
+func (s *OAuth2TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken != "" && time.Until(s.expiry) > time.Minute {
+		return s.accessToken, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.refreshToken},
+		"client_id":     {s.ClientID},
+	}
+	if s.ClientSecret != "" {
+		form.Set("client_secret", s.ClientSecret)
+	}
+	if s.Scope != "" {
+		form.Set("scope", s.Scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("刷新 OAuth2 token 失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token oauth2TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("解析 OAuth2 token 失败（HTTP %d）: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", fmt.Errorf("刷新 OAuth2 token 失败（HTTP %d）: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+
+	s.accessToken = token.AccessToken
+	s.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	if token.RefreshToken != "" && token.RefreshToken != s.refreshToken {
+		s.refreshToken = token.RefreshToken
+		if s.tokenFile != "" {
+			if err := writeTokenFile(s.tokenFile, token.RefreshToken); err != nil {
+				log.Printf("保存新的 refresh token 失败: %v", err)
+			}
+		}
+	}
+	return s.accessToken, nil
+}
+
+// writeTokenFile 先写入同目录下的临时文件再改名替换，写入中途失败（磁盘已满、进程退出）时原文件保持不变。
+// 旧的 refresh token 被轮换后可能已经失效，文件损坏就只能重新授权
+func writeTokenFile(path, refreshToken string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // 改名成功后临时文件已不存在
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(refreshToken + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Invalidate 丢弃缓存的 access token，下次使用时重新刷新，用于服务器拒绝 token 之后
+func (s *OAuth2TokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = ""
+}
+
+// xoauth2Response 按 XOAUTH2 格式拼接初始响应
+func xoauth2Response(username, token string) []byte {
+	return []byte("user=" + username + "\x01auth=Bearer " + token + "\x01\x01")
+}
+
+// xoauth2Error 服务器拒绝 XOAUTH2 登录时返回的 JSON 错误说明
+func xoauth2Error(challenge []byte) error {
+	return fmt.Errorf("XOAUTH2 登录被拒绝: %s", strings.TrimSpace(string(challenge)))
+}
+
+// XOAuth2Auth 使用 OAuth2 access token 以 XOAUTH2 方式登录，用于禁用了密码登录的 Gmail 和 Microsoft 365 邮箱
+type XOAuth2Auth struct {
+	Tokens *OAuth2TokenSource
+}
+
+// NewXOAuth2Auth 创建 XOAUTH2 登录方式
+func NewXOAuth2Auth(tokens *OAuth2TokenSource) *XOAuth2Auth {
+	return &XOAuth2Auth{Tokens: tokens}
+}
+
+func (a *XOAuth2Auth) SMTPAuth(account *MailAccount) smtp.Auth {
+	return &xoauth2SMTPAuth{username: account.Username, tokens: a.Tokens}
+}
+
+func (a *XOAuth2Auth) LoginIMAP(ctx context.Context, c *client.Client, account *MailAccount) error {
+	token, err := a.Tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.Authenticate(&xoauth2SASLClient{username: account.Username, token: token}); err != nil {
+		a.Tokens.Invalidate() // token 可能已被撤销，下次重新刷新
+		return err
+	}
+	return nil
+}
+
+// xoauth2SMTPAuth 实现 smtp.Auth，在 gomail 拨号时取得 access token
+type xoauth2SMTPAuth struct {
+	username string
+	tokens   *OAuth2TokenSource
+}
+
+func (a *xoauth2SMTPAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("XOAUTH2 只能在加密连接上使用")
+	}
+	token, err := a.tokens.Token(context.Background())
+	if err != nil {
+		return "", nil, err
+	}
+	return "XOAUTH2", xoauth2Response(a.username, token), nil
+}
+
+func (a *xoauth2SMTPAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// 登录失败时服务器先返回 JSON 错误说明，客户端取消后以 535 结束
+		a.tokens.Invalidate()
+		return nil, xoauth2Error(fromServer)
+	}
+	return nil, nil
+}
+
+// xoauth2SASLClient 实现 go-imap 使用的 sasl.Client 接口（go-sasl 没有提供 XOAUTH2）
+type xoauth2SASLClient struct {
+	username string
+	token    string
+}
+
+func (c *xoauth2SASLClient) Start() (string, []byte, error) {
+	return "XOAUTH2", xoauth2Response(c.username, c.token), nil
+}
+
+func (c *xoauth2SASLClient) Next(challenge []byte) ([]byte, error) {
+	// 登录失败时服务器返回 JSON 错误说明，按规范回复空响应后服务器以 NO 结束
+	log.Printf("XOAUTH2 登录被拒绝: %s", strings.TrimSpace(string(challenge)))
+	return []byte{}, nil
+}
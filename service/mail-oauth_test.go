@@ -0,0 +1,243 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/client"
+)
+
+// tokenReply token 接口的一次预设响应
+type tokenReply struct {
+	status int
+	body   string
+}
+
+// fakeTokenEndpoint 模拟 OAuth2 token 接口，按顺序返回预设的响应，记录每次请求携带的 refresh token
+type fakeTokenEndpoint struct {
+	mu        sync.Mutex
+	responses []tokenReply
+	received  []string
+}
+
+func (f *fakeTokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+	f.received = append(f.received, r.PostForm.Get("refresh_token"))
+	if len(f.responses) == 0 {
+		http.Error(w, `{"error":"unexpected_request"}`, http.StatusInternalServerError)
+		return
+	}
+	reply := f.responses[0]
+	f.responses = f.responses[1:]
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(reply.status)
+	w.Write([]byte(reply.body))
+}
+
+func (f *fakeTokenEndpoint) requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.received...)
+}
+
+func startTokenEndpoint(t *testing.T, responses ...tokenReply) (*fakeTokenEndpoint, string) {
+	t.Helper()
+	endpoint := &fakeTokenEndpoint{responses: responses}
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+	return endpoint, server.URL
+}
+
+// TestOAuth2TokenSource 覆盖缓存、过期刷新、refresh token 轮换写回和错误响应
+func TestOAuth2TokenSource(t *testing.T) {
+	endpoint, tokenURL := startTokenEndpoint(t,
+		tokenReply{200, `{"access_token":"access-1","expires_in":3600}`},
+		tokenReply{200, `{"access_token":"access-2","expires_in":3600,"refresh_token":"refresh-2"}`},
+		tokenReply{400, `{"error":"invalid_grant","error_description":"token revoked"}`},
+	)
+	tokenFile := filepath.Join(t.TempDir(), "refresh-token")
+	if err := os.WriteFile(tokenFile, []byte("refresh-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewOAuth2TokenSource(tokenURL, "client", "secret", "", "", tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	token, err := source.Token(ctx)
+	if err != nil || token != "access-1" {
+		t.Fatalf("first Token = %q, %v, want access-1", token, err)
+	}
+	// 有效期内直接使用缓存，不请求 token 接口
+	if token, err := source.Token(ctx); err != nil || token != "access-1" {
+		t.Fatalf("cached Token = %q, %v, want access-1", token, err)
+	}
+	if got := endpoint.requests(); len(got) != 1 {
+		t.Fatalf("token endpoint requests = %v, want 1 before expiry", got)
+	}
+
+	// 剩余有效期不足 1 分钟时刷新，服务器返回新的 refresh token 后写回文件
+	source.mu.Lock()
+	source.expiry = time.Now().Add(30 * time.Second)
+	source.mu.Unlock()
+	if token, err := source.Token(ctx); err != nil || token != "access-2" {
+		t.Fatalf("refreshed Token = %q, %v, want access-2", token, err)
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil || strings.TrimSpace(string(data)) != "refresh-2" {
+		t.Fatalf("token file = %q, %v, want rotated refresh-2", data, err)
+	}
+	info, err := os.Stat(tokenFile)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("token file mode = %v, %v, want 0600", info, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(tokenFile))
+	if len(entries) != 1 {
+		t.Errorf("token directory has %d entries, want no leftover temp files", len(entries))
+	}
+
+	// 错误响应返回服务器的错误说明，文件中的 refresh token 保持不变
+	source.Invalidate()
+	_, err = source.Token(ctx)
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") || !strings.Contains(err.Error(), "HTTP 400") {
+		t.Fatalf("Token error = %v, want invalid_grant with HTTP 400", err)
+	}
+	if data, _ := os.ReadFile(tokenFile); strings.TrimSpace(string(data)) != "refresh-2" {
+		t.Errorf("token file after error = %q, want refresh-2", data)
+	}
+
+	want := []string{"refresh-1", "refresh-1", "refresh-2"}
+	if got := endpoint.requests(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("refresh tokens sent = %v, want %v", got, want)
+	}
+}
+
+// TestXOAuth2SMTPAuth 检查发信时的 XOAUTH2 交互：只在加密连接上登录，被拒绝后丢弃 access token
+func TestXOAuth2SMTPAuth(t *testing.T) {
+	endpoint, tokenURL := startTokenEndpoint(t,
+		tokenReply{200, `{"access_token":"access-1","expires_in":3600}`},
+		tokenReply{200, `{"access_token":"access-2","expires_in":3600}`},
+	)
+	source, err := NewOAuth2TokenSource(tokenURL, "client", "", "", "refresh-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewXOAuth2Auth(source).SMTPAuth(&MailAccount{Username: "user@example.com"})
+
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: false}); err == nil {
+		t.Fatal("Start on plain connection succeeded, want refusal")
+	}
+	if got := endpoint.requests(); len(got) != 0 {
+		t.Fatalf("token endpoint requested %d times on plain connection", len(got))
+	}
+
+	mech, response, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "user=user@example.com\x01auth=Bearer access-1\x01\x01"; mech != "XOAUTH2" || string(response) != want {
+		t.Fatalf("Start = %s %q, want XOAUTH2 %q", mech, response, want)
+	}
+
+	// 服务器返回 JSON 错误说明表示登录失败
+	if _, err := auth.Next([]byte(`{"status":"401","schemes":"bearer"}`), true); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("Next error = %v, want rejection with server details", err)
+	}
+	if _, response, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true}); err != nil || !strings.Contains(string(response), "access-2") {
+		t.Fatalf("Start after rejection = %q, %v, want refreshed access-2", response, err)
+	}
+}
+
+// TestXOAuth2IMAPLogin 与模拟的 IMAP 服务器完成 AUTHENTICATE XOAUTH2，登录失败时丢弃 access token
+func TestXOAuth2IMAPLogin(t *testing.T) {
+	_, tokenURL := startTokenEndpoint(t,
+		tokenReply{200, `{"access_token":"access-1","expires_in":3600}`},
+		tokenReply{200, `{"access_token":"access-2","expires_in":3600}`},
+	)
+	source, err := NewOAuth2TokenSource(tokenURL, "client", "", "", "refresh-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewXOAuth2Auth(source)
+	account := &MailAccount{Username: "user@example.com"}
+
+	login := func(accepted string) error {
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		go serveXOAuth2IMAP(serverConn, accepted)
+		c, err := client.New(clientConn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Timeout = 5 * time.Second
+		return auth.LoginIMAP(context.Background(), c, account)
+	}
+
+	// 服务器只接受 access-2，第一次登录失败后 access-1 被丢弃，第二次登录重新刷新
+	if err := login("access-2"); err == nil {
+		t.Fatal("login with rejected token succeeded")
+	}
+	if err := login("access-2"); err != nil {
+		t.Fatalf("login after refresh: %v", err)
+	}
+}
+
+// serveXOAuth2IMAP 处理一次 IMAP 连接，只接受携带 accepted token 的 XOAUTH2 登录
+func serveXOAuth2IMAP(conn net.Conn, accepted string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	conn.Write([]byte("* OK IMAP4rev1 ready\r\n"))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return
+		}
+		tag, command := fields[0], strings.ToUpper(fields[1])
+		switch command {
+		case "CAPABILITY":
+			conn.Write([]byte("* CAPABILITY IMAP4rev1 AUTH=XOAUTH2 SASL-IR\r\n" + tag + " OK done\r\n"))
+		case "AUTHENTICATE":
+			if len(fields) < 4 || strings.ToUpper(fields[2]) != "XOAUTH2" {
+				conn.Write([]byte(tag + " BAD missing initial response\r\n"))
+				continue
+			}
+			response, _ := base64.StdEncoding.DecodeString(fields[3])
+			if string(response) == "user=user@example.com\x01auth=Bearer "+accepted+"\x01\x01" {
+				conn.Write([]byte(tag + " OK authenticated\r\n"))
+				continue
+			}
+			challenge := base64.StdEncoding.EncodeToString([]byte(`{"status":"400","schemes":"Bearer"}`))
+			conn.Write([]byte("+ " + challenge + "\r\n"))
+			if _, err := reader.ReadString('\n'); err != nil {
+				return
+			}
+			conn.Write([]byte(tag + " NO [AUTHENTICATIONFAILED] invalid credentials\r\n"))
+		case "LOGOUT":
+			conn.Write([]byte("* BYE\r\n" + tag + " OK bye\r\n"))
+			return
+		default:
+			conn.Write([]byte(tag + " BAD unsupported\r\n"))
+		}
+	}
+}
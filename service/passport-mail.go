@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/config"
+	"crawler-visa/models"
+	"crawler-visa/utils"
+	"github.com/emersion/go-imap"
+	imapID "github.com/emersion/go-imap-id"
+	"github.com/emersion/go-imap/client"
+	_ "github.com/emersion/go-message/charset" // 支持 GBK、GB2312 等非 UTF-8 编码的邮件
+	"github.com/emersion/go-message/mail"
+	"gopkg.in/gomail.v2"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// passportStatusAddress ustraveldocs 接收护照状态查询的邮箱，邮件标题为护照号
+const passportStatusAddress = "passportstatus@ustraveldocs.com"
+
+// mailClockSkew 本机与邮件服务器之间允许的时钟误差，早于发送时间减去该误差的邮件不会被当作回复
+const mailClockSkew = time.Minute
+
+// passportReplyResult 解析回复邮件，返回护照状态查询结果
+func passportReplyResult(passportNumber string, msg *imap.Message) (models.UsStatus, error) {
+	raw, text, err := readReplyBody(msg)
+	if err != nil {
+		return models.UsStatus{}, newCrawlError(ErrMailFailed, err, "解析回复邮件")
+	}
+	passport := models.ParsePassportStatus(text)
+	passport.PassportNumber = passportNumber
+	passport.ReceivedAt = msg.InternalDate
+	log.Printf("护照 %s 状态: %s", passportNumber, passport.Summary())
+	return models.UsStatus{StatusContent: raw, Passport: &passport}, nil
+}
+
+// sendPassportRequest 使用 account 发送以护照号为标题的查询邮件，回复会发到该账号的收件箱
+func sendPassportRequest(account *MailAccount, passportNumber string) error {
+	msg := gomail.NewMessage()
+	msg.SetHeader("From", account.From)
+	msg.SetHeader("To", passportStatusAddress)
+	msg.SetHeader("Subject", passportNumber)
+	msg.SetBody("text/html", passportNumber)
+	return account.smtpDialer().DialAndSend(msg)
+}
+
+// dialMailbox 登录 account 的收件邮箱并选中收件箱
+func dialMailbox(ctx context.Context, account *MailAccount) (*client.Client, error) {
+	c, err := account.dialIMAP(config.GetEnvDuration("STEP_TIMEOUT", 30*time.Second))
+	if err != nil {
+		return nil, mailError(ctx, err, "连接收件服务器 "+account.IMAP.Host)
+	}
+	if err := account.authenticator().LoginIMAP(ctx, c, account); err != nil {
+		c.Logout()
+		return nil, mailError(ctx, err, "登录收件邮箱 "+account.Username)
+	}
+	if account.IMAPID {
+		// 网易邮箱要求登录后上报客户端 ID，否则拒绝 SELECT
+		if _, err := imapID.NewClient(c).ID(imapID.ID{
+			imapID.FieldName:    "IMAPClient",
+			imapID.FieldVersion: "3.1.0",
+		}); err != nil {
+			c.Logout()
+			return nil, mailError(ctx, err, "上报客户端 ID")
+		}
+	}
+	if _, err := c.Select("INBOX", true); err != nil {
+		c.Logout()
+		return nil, mailError(ctx, err, "打开收件箱")
+	}
+	return c, nil
+}
+
+// searchPassportReply 搜索标题或正文包含护照号的邮件，返回收件时间不早于 sentAt 的最新一封，没有时返回 nil。
+// IMAP 的 SINCE 只精确到日期，具体时间通过 INTERNALDATE 再筛选一次。
+func searchPassportReply(c *client.Client, passportNumber string, sentAt time.Time) (*imap.Message, error) {
+	subject := imap.NewSearchCriteria()
+	subject.Header.Add("Subject", passportNumber)
+	body := imap.NewSearchCriteria()
+	body.Body = []string{passportNumber}
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = sentAt.Add(-24 * time.Hour) // 服务器按自己的时区比较日期，多放宽一天
+	criteria.Or = [][2]*imap.SearchCriteria{{subject, body}}
+
+	uids, err := c.UidSearch(criteria)
+	if err != nil || len(uids) == 0 {
+		return nil, err
+	}
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	messages := make(chan *imap.Message, len(uids))
+	if err := c.UidFetch(seqset, []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate, imap.FetchUid}, messages); err != nil {
+		return nil, err
+	}
+	var latest *imap.Message
+	for msg := range messages {
+		if msg.InternalDate.Before(sentAt.Add(-mailClockSkew)) {
+			continue
+		}
+		if latest == nil || msg.InternalDate.After(latest.InternalDate) {
+			latest = msg
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	// 只下载选中邮件的正文
+	seqset = new(imap.SeqSet)
+	seqset.AddNum(latest.Uid)
+	messages = make(chan *imap.Message, 1)
+	if err := c.UidFetch(seqset, []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate, imap.FetchUid, "BODY.PEEK[]"}, messages); err != nil {
+		return nil, err
+	}
+	return <-messages, nil
+}
+
+// readReplyBody 读取邮件正文，忽略附件。raw 为所有内联部分（已解码传输编码并转换为 UTF-8）拼接后的内容，
+// text 为用于解析的纯文本：有 text/plain 部分时使用它，否则把 text/html 部分转换为纯文本
+func readReplyBody(msg *imap.Message) (raw, text string, err error) {
+	body := msg.GetBody(&imap.BodySectionName{Peek: true})
+	if body == nil {
+		return "", "", nil
+	}
+	mr, err := mail.CreateReader(body)
+	if err != nil && mr == nil {
+		return "", "", err
+	}
+	var all, plain, htmlText strings.Builder
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", "", err
+		}
+		header, ok := p.Header.(*mail.InlineHeader)
+		if !ok {
+			continue
+		}
+		b, err := io.ReadAll(p.Body)
+		if err != nil {
+			return "", "", err
+		}
+		all.Write(b)
+		switch contentType, _, _ := header.ContentType(); contentType {
+		case "text/html":
+			htmlText.WriteString(utils.HTMLToText(string(b)) + "\n")
+		case "text/plain", "":
+			plain.Write(b)
+			plain.WriteString("\n")
+		}
+	}
+	text = plain.String()
+	if strings.TrimSpace(text) == "" {
+		text = htmlText.String()
+	}
+	return all.String(), text, nil
+}
+
+// mailError 把 IMAP 操作的错误转换为查询错误，ctx 已结束时返回超时或取消错误
+func mailError(ctx context.Context, err error, step string) error {
+	if ctx.Err() != nil {
+		return contextError(ctx, err)
+	}
+	return newCrawlError(ErrMailFailed, err, "%s", step)
+}
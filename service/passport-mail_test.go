@@ -0,0 +1,110 @@
+package service
+
+import (
+	"bytes"
+	"crawler-visa/models"
+	"encoding/base64"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// replyMessage 构造 IMAP 取回的回复邮件，body 为邮件头之后的原始内容
+func replyMessage(contentType, encoding, body string) *imap.Message {
+	raw := "From: passportstatus@ustraveldocs.com\r\nSubject: RE: E12345678\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: " + contentType + "\r\nContent-Transfer-Encoding: " + encoding + "\r\n\r\n" + body
+	return &imap.Message{
+		InternalDate: time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC),
+		Body:         map[*imap.BodySectionName]imap.Literal{{}: bytes.NewBufferString(raw)},
+	}
+}
+
+func quotedPrintable(t *testing.T, data []byte) string {
+	var buf bytes.Buffer
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+func gbk(t *testing.T, text string) []byte {
+	data, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPassportReplyResult(t *testing.T) {
+	htmlReply := `<html><head><style>p { color: #333 }</style></head><body>` +
+		`<p>Dear Applicant,</p><table><tr><td>Passport Number:</td><td>E12345678</td></tr>` +
+		`<tr><td>Status:</td><td>Ready for pick up</td></tr>` +
+		`<tr><td>Pickup Location:</td><td>CITIC Bank, Tianhe Branch</td></tr></table>` +
+		`<p>You will be notified when your passport is dispatched.</p></body></html>`
+	chinese := "尊敬的申请人：\r\n护照状态：已寄出\r\n快递单号：SF1234567890\r\n"
+
+	tests := []struct {
+		name     string
+		msg      *imap.Message
+		state    models.PassportState
+		location string
+		tracking string
+	}{
+		{
+			name:  "纯文本",
+			msg:   replyMessage("text/plain; charset=us-ascii", "7bit", "Dear Applicant,\r\nYour passport has not yet been dispatched.\r\n"),
+			state: models.PassportStateNotFound,
+		},
+		{
+			name:     "只有 HTML",
+			msg:      replyMessage("text/html; charset=utf-8", "quoted-printable", quotedPrintable(t, []byte(htmlReply))),
+			state:    models.PassportStateReadyForPickup,
+			location: "CITIC Bank, Tianhe Branch",
+		},
+		{
+			name:     "GBK base64",
+			msg:      replyMessage("text/plain; charset=gbk", "base64", base64Lines(gbk(t, chinese))),
+			state:    models.PassportStateDispatched,
+			tracking: "SF1234567890",
+		},
+		{
+			name:     "GB2312 quoted-printable",
+			msg:      replyMessage("text/plain; charset=gb2312", "quoted-printable", quotedPrintable(t, gbk(t, chinese))),
+			state:    models.PassportStateDispatched,
+			tracking: "SF1234567890",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := passportReplyResult("E12345678", tt.msg)
+			if err != nil {
+				t.Fatalf("passportReplyResult() error = %v", err)
+			}
+			p := result.Passport
+			if p.State != tt.state || p.Location != tt.location || p.TrackingNumber != tt.tracking {
+				t.Errorf("passport = %+v, want %s %q %q", p, tt.state, tt.location, tt.tracking)
+			}
+			if p.PassportNumber != "E12345678" || !p.ReceivedAt.Equal(tt.msg.InternalDate) {
+				t.Errorf("passport = %+v, want number and received time filled", p)
+			}
+			if strings.Contains(result.StatusContent, "=E") || strings.Contains(p.Text, "�") {
+				t.Errorf("body was not decoded: %q", result.StatusContent)
+			}
+		})
+	}
+}
+
+func base64Lines(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var lines []string
+	for len(encoded) > 76 {
+		lines, encoded = append(lines, encoded[:76]), encoded[76:]
+	}
+	return strings.Join(append(lines, encoded), "\r\n")
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/config"
+	"crawler-visa/models"
+	"github.com/emersion/go-imap/client"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PassportFuture 一次护照状态查询的结果，回复邮件到达、等待超时或流水线关闭时完成
+type PassportFuture struct {
+	done   chan struct{}
+	result models.UsStatus
+	err    error
+}
+
+func newPassportFuture() *PassportFuture {
+	return &PassportFuture{done: make(chan struct{})}
+}
+
+// complete 设置结果，只能调用一次
+func (f *PassportFuture) complete(result models.UsStatus, err error) {
+	f.result, f.err = result, err
+	close(f.done)
+}
+
+// Done 返回查询完成时关闭的通道
+func (f *PassportFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result 返回查询结果，需在 Done 关闭后调用
+func (f *PassportFuture) Result() (models.UsStatus, error) {
+	return f.result, f.err
+}
+
+// Wait 等待查询完成。ctx 结束时返回超时或取消错误，查询本身仍会继续，同一护照的其他等待方不受影响
+func (f *PassportFuture) Wait(ctx context.Context) (models.UsStatus, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return models.UsStatus{}, contextError(ctx, ctx.Err())
+	}
+}
+
+// passportRequest 一个等待回复的护照查询，同一护照号同时只有一个，后来的查询共用它的结果
+type passportRequest struct {
+	passportNumber string
+	future         *PassportFuture
+	account        *MailAccount // 发送查询邮件的账号，回复在它的收件箱中
+	sentAt         time.Time    // 邮件发送时间，为零表示还在发送队列中
+	deadline       time.Time    // 整个查询的截止时间，从提交时开始计算，发信后不晚于发送时间加等待回复的时限
+}
+
+// PassportPipeline 异步的护照状态查询流水线。
+// 发送协程按 sendInterval 的间隔依次发出查询邮件，发件账号从账号池中轮流选取；监听协程为每个发件账号保持一个
+// 常驻的 IMAP 连接，每隔 pollInterval 为所有已发出的查询搜索回复，找到后通过 PassportFuture 返回结果，
+// 使多个护照可以同时查询。每个查询从提交起最多进行 trackingTimeout，包括在发送队列中等待的时间。
+type PassportPipeline struct {
+	accounts        *MailAccountPool
+	trackingTimeout time.Duration
+	replyTimeout    time.Duration
+	pollInterval    time.Duration
+	sendInterval    time.Duration
+
+	// 发送邮件和登录收件箱的实现
+	send func(account *MailAccount, passportNumber string) error
+	dial func(ctx context.Context, account *MailAccount) (*client.Client, error)
+
+	mu      sync.Mutex
+	pending map[string]*passportRequest // 按大写护照号索引
+	lastErr error                       // 监听协程最近一次连接或搜索失败的原因
+	closed  bool
+
+	queue  chan *passportRequest
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPassportPipeline 创建并启动护照查询流水线
+func NewPassportPipeline(accounts *MailAccountPool, trackingTimeout, replyTimeout, pollInterval, sendInterval time.Duration) *PassportPipeline {
+	p := newPassportPipeline(accounts, trackingTimeout, replyTimeout, pollInterval, sendInterval)
+	p.start()
+	return p
+}
+
+// newPassportPipeline 创建流水线但不启动，便于启动前替换发信和登录的实现
+func newPassportPipeline(accounts *MailAccountPool, trackingTimeout, replyTimeout, pollInterval, sendInterval time.Duration) *PassportPipeline {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PassportPipeline{
+		accounts:        accounts,
+		trackingTimeout: trackingTimeout,
+		replyTimeout:    replyTimeout,
+		pollInterval:    pollInterval,
+		sendInterval:    sendInterval,
+		send:            sendPassportRequest,
+		dial:            dialMailbox,
+		pending:         make(map[string]*passportRequest),
+		queue:           make(chan *passportRequest, 1024),
+		wake:            make(chan struct{}, 1),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+}
+
+func (p *PassportPipeline) start() {
+	p.wg.Add(2)
+	go p.sendLoop()
+	go p.listenLoop()
+}
+
+var (
+	passportPipelineMu sync.Mutex
+	passportPipeline   *PassportPipeline
+)
+
+// DefaultPassportPipeline 返回全局共用的护照查询流水线，第一次使用时启动，发件账号见 DefaultMailAccountPool。
+// 每个查询从提交起的整体时限由 EMAIL_TRACKING_TIMEOUT（默认 5 分钟）配置，发信后等待回复的时限由
+// EMAIL_REPLY_TIMEOUT（默认 90 秒）配置，搜索收件箱的间隔由 EMAIL_POLL_INTERVAL（默认 5 秒）配置，
+// 相邻两封查询邮件的发送间隔由 EMAIL_SEND_INTERVAL（默认 2 秒）配置。
+func DefaultPassportPipeline() *PassportPipeline {
+	passportPipelineMu.Lock()
+	defer passportPipelineMu.Unlock()
+	if passportPipeline == nil {
+		passportPipeline = NewPassportPipeline(DefaultMailAccountPool(),
+			emailTrackingTimeout(),
+			config.GetEnvDuration("EMAIL_REPLY_TIMEOUT", 90*time.Second),
+			config.GetEnvDuration("EMAIL_POLL_INTERVAL", 5*time.Second),
+			config.GetEnvDuration("EMAIL_SEND_INTERVAL", 2*time.Second),
+		)
+	}
+	return passportPipeline
+}
+
+// emailTrackingTimeout 返回护照查询的整体时限
+func emailTrackingTimeout() time.Duration {
+	return config.GetEnvDuration("EMAIL_TRACKING_TIMEOUT", 5*time.Minute)
+}
+
+// ClosePassportPipeline 关闭全局护照查询流水线，用于服务关闭。流水线还没有启动过时不做任何事
+func ClosePassportPipeline() {
+	passportPipelineMu.Lock()
+	p := passportPipeline
+	passportPipelineMu.Unlock()
+	if p != nil {
+		p.Close()
+	}
+}
+
+// Submit 提交一个护照状态查询，立即返回。同一护照号已有查询在进行时直接共用它的结果，不重复发信
+func (p *PassportPipeline) Submit(passportNumber string) *PassportFuture {
+	key := strings.ToUpper(strings.TrimSpace(passportNumber))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if req, ok := p.pending[key]; ok {
+		return req.future
+	}
+	future := newPassportFuture()
+	if p.closed {
+		future.complete(models.UsStatus{}, newCrawlError(ErrCheckCanceled, nil, "护照查询流水线已关闭"))
+		return future
+	}
+	req := &passportRequest{passportNumber: passportNumber, future: future, deadline: time.Now().Add(p.trackingTimeout)}
+	select {
+	case p.queue <- req:
+		p.pending[key] = req
+	default:
+		future.complete(models.UsStatus{}, newCrawlError(ErrMailFailed, nil, "发送队列已满"))
+	}
+	return future
+}
+
+// Pending 返回正在进行的查询数量（包括还在发送队列中的）
+func (p *PassportPipeline) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+// Close 停止发送和监听，所有未完成的查询以 ErrCheckCanceled 结束
+func (p *PassportPipeline) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.cancel()
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, req := range p.pending {
+		req.future.complete(models.UsStatus{}, newCrawlError(ErrCheckCanceled, nil, "护照查询流水线已关闭"))
+		delete(p.pending, key)
+	}
+}
+
+// isPending 判断查询是否还未结束
+func (p *PassportPipeline) isPending(req *passportRequest) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pending[strings.ToUpper(strings.TrimSpace(req.passportNumber))] == req
+}
+
+// finish 结束一个查询并从等待列表中移除
+func (p *PassportPipeline) finish(req *passportRequest, result models.UsStatus, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := strings.ToUpper(strings.TrimSpace(req.passportNumber))
+	if p.pending[key] != req {
+		return // 已经结束
+	}
+	delete(p.pending, key)
+	req.future.complete(result, err)
+}
+
+// sendLoop 依次发送队列中的查询邮件，发送成功后开始计算等待回复的时限。在队列中已经超时的查询不再发送
+func (p *PassportPipeline) sendLoop() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case req := <-p.queue:
+			if !p.isPending(req) {
+				continue
+			}
+			account, err := p.accounts.Next(time.Now())
+			if err != nil {
+				p.finish(req, models.UsStatus{}, newCrawlError(ErrMailFailed, err, "选择发件邮箱"))
+				continue // 没有发信，不需要等待发送间隔
+			}
+			if err := p.send(account, req.passportNumber); err != nil {
+				log.Printf("使用 %s 发送护照 %s 的查询邮件失败: %v", account.From, req.passportNumber, err)
+				p.finish(req, models.UsStatus{}, newCrawlError(ErrMailFailed, err, "发送查询邮件 %s", account.From))
+			} else {
+				log.Printf("已使用 %s 发送护照 %s 的查询邮件，等待回复", account.From, req.passportNumber)
+				p.mu.Lock()
+				req.account = account
+				req.sentAt = time.Now()
+				if replyDeadline := req.sentAt.Add(p.replyTimeout); replyDeadline.Before(req.deadline) {
+					req.deadline = replyDeadline
+				}
+				p.mu.Unlock()
+				select {
+				case p.wake <- struct{}{}:
+				default:
+				}
+			}
+			select {
+			case <-time.After(p.sendInterval):
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// listenLoop 为每个发件账号保持一个 IMAP 连接，定期为已发出的查询搜索回复，并结束超时的查询。
+// 没有等待中的查询时不搜索；连接断开后在下一轮重新登录。
+func (p *PassportPipeline) listenLoop() {
+	defer p.wg.Done()
+	conns := make(map[*MailAccount]*client.Client)
+	stops := make(map[*MailAccount]func() bool)
+	disconnect := func(account *MailAccount) {
+		if c, ok := conns[account]; ok {
+			stops[account]()
+			c.Logout()
+			delete(conns, account)
+			delete(stops, account)
+		}
+	}
+	defer func() {
+		for account := range conns {
+			disconnect(account)
+		}
+	}()
+
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+
+		byAccount := make(map[*MailAccount][]*passportRequest)
+		for _, req := range p.expire(time.Now()) {
+			byAccount[req.account] = append(byAccount[req.account], req)
+		}
+		for account, waiting := range byAccount {
+			c, ok := conns[account]
+			if !ok {
+				var err error
+				if c, err = p.dial(p.ctx, account); err != nil {
+					p.setLastErr(err)
+					log.Printf("护照查询收件箱 %s 连接失败，稍后重试: %v", account.Username, err)
+					continue
+				}
+				p.setLastErr(nil)
+				conns[account] = c
+				stops[account] = context.AfterFunc(p.ctx, func() { c.Terminate() }) // 关闭时中断阻塞中的 IMAP 命令
+			}
+			for _, req := range waiting {
+				msg, err := searchPassportReply(c, req.passportNumber, req.sentAt)
+				if err != nil {
+					p.setLastErr(err)
+					log.Printf("在 %s 中搜索护照 %s 的回复邮件失败，重新连接: %v", account.Username, req.passportNumber, err)
+					disconnect(account)
+					break
+				}
+				if msg != nil {
+					log.Printf("收到护照 %s 的回复邮件: %s（%s）", req.passportNumber, msg.Envelope.Subject, msg.InternalDate.Format(time.DateTime))
+					result, err := passportReplyResult(req.passportNumber, msg)
+					p.finish(req, result, err)
+				}
+			}
+		}
+	}
+}
+
+// expire 结束超过截止时间的查询：还在发送队列中的以 ErrCheckTimeout 结束，已发信的以 ErrPassportReplyTimeout 结束。
+// 返回其余已发出、正在等待回复的查询
+func (p *PassportPipeline) expire(now time.Time) []*passportRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var waiting []*passportRequest
+	for key, req := range p.pending {
+		if now.Before(req.deadline) {
+			if !req.sentAt.IsZero() {
+				waiting = append(waiting, req)
+			}
+			continue
+		}
+		var err error
+		if req.sentAt.IsZero() {
+			err = newCrawlError(ErrCheckTimeout, nil, "护照 %s 在 %s 内没有发出查询邮件", req.passportNumber, p.trackingTimeout)
+		} else {
+			err = newCrawlError(ErrPassportReplyTimeout, p.lastErr, "护照 %s 发信后 %s 内没有收到回复",
+				req.passportNumber, req.deadline.Sub(req.sentAt).Round(time.Second))
+		}
+		delete(p.pending, key)
+		req.future.complete(models.UsStatus{}, err)
+	}
+	return waiting
+}
+
+func (p *PassportPipeline) setLastErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastErr = err
+}
+
+// RunVisaEmailTracking 通过全局护照查询流水线查询护照状态：发送护照号到 ustraveldocs，等待标题或正文包含该护照号、
+// 且晚于发送时间的回复。EMAIL_REPLY_TIMEOUT 内没有收到回复时返回 ErrPassportReplyTimeout。
+// 整个查询（包括排队发信）受 EMAIL_TRACKING_TIMEOUT 限制，ctx 结束时立即返回，已发出的查询不会撤回。
+func RunVisaEmailTracking(ctx context.Context, usStatus *models.QueryUsStatus) (models.UsStatus, error) {
+	if usStatus.PassportNumber == "" {
+		return models.UsStatus{}, newCrawlError(ErrInvalidQuery, nil, "护照状态查询需要填写 passport_number")
+	}
+	ctx, cancel := context.WithTimeout(ctx, emailTrackingTimeout())
+	defer cancel()
+	return DefaultPassportPipeline().Submit(usStatus.PassportNumber).Wait(ctx)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/client"
+)
+
+var errNoMailbox = errors.New("测试中没有收件箱")
+
+// newTestPipeline 创建不连接真实邮箱的流水线：send 替换发信实现，收件箱总是无法登录
+func newTestPipeline(t *testing.T, trackingTimeout, replyTimeout time.Duration, send func(account *MailAccount, passportNumber string) error) *PassportPipeline {
+	p := newPassportPipeline(NewMailAccountPool([]*MailAccount{{Name: "test", Username: "test@example.com", From: "test@example.com"}}),
+		trackingTimeout, replyTimeout, 10*time.Millisecond, 0)
+	p.send = send
+	p.dial = func(ctx context.Context, account *MailAccount) (*client.Client, error) {
+		return nil, errNoMailbox
+	}
+	p.start()
+	t.Cleanup(p.Close)
+	return p
+}
+
+func waitFuture(t *testing.T, future *PassportFuture) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := future.Wait(ctx)
+	if errors.Is(err, ErrCheckTimeout) && ctx.Err() != nil {
+		t.Fatal("查询没有在截止时间结束")
+	}
+	return err
+}
+
+func TestPassportPipelineQueuedDeadline(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var sent []string
+	p := newTestPipeline(t, 100*time.Millisecond, time.Minute, func(account *MailAccount, passportNumber string) error {
+		mu.Lock()
+		sent = append(sent, passportNumber)
+		mu.Unlock()
+		<-release // 第一封邮件一直发不出去，后面的查询只能在队列中等待
+		return nil
+	})
+
+	first := p.Submit("E00000001")
+	time.Sleep(20 * time.Millisecond) // 等待发送协程取出第一个查询
+	queued := p.Submit("E00000002")
+
+	start := time.Now()
+	err := waitFuture(t, queued)
+	if !errors.Is(err, ErrCheckTimeout) {
+		t.Fatalf("queued request error = %v, want ErrCheckTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("queued request finished after %s", elapsed)
+	}
+
+	// 正在发送的查询同样受整体时限限制
+	if err := waitFuture(t, first); !errors.Is(err, ErrCheckTimeout) {
+		t.Errorf("first request error = %v, want ErrCheckTimeout", err)
+	}
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 || sent[0] != "E00000001" {
+		t.Errorf("sent = %v, 超时的查询不应再发信", sent)
+	}
+	if p.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", p.Pending())
+	}
+}
+
+func TestPassportPipelineReplyTimeout(t *testing.T) {
+	p := newTestPipeline(t, time.Minute, 50*time.Millisecond, func(account *MailAccount, passportNumber string) error {
+		return nil
+	})
+
+	future := p.Submit("E00000001")
+	if again := p.Submit(" e00000001 "); again != future {
+		t.Error("同一护照号的查询没有共用结果")
+	}
+	err := waitFuture(t, future)
+	if !errors.Is(err, ErrPassportReplyTimeout) {
+		t.Fatalf("error = %v, want ErrPassportReplyTimeout", err)
+	}
+	if !errors.Is(err, errNoMailbox) {
+		t.Errorf("error = %v, want the last mailbox error as cause", err)
+	}
+}
+
+func TestPassportPipelineSendFailed(t *testing.T) {
+	p := newTestPipeline(t, time.Minute, time.Minute, func(account *MailAccount, passportNumber string) error {
+		return errors.New("smtp down")
+	})
+	if err := waitFuture(t, p.Submit("E00000001")); !errors.Is(err, ErrMailFailed) {
+		t.Errorf("error = %v, want ErrMailFailed", err)
+	}
+}
+
+func TestPassportPipelineClose(t *testing.T) {
+	p := newTestPipeline(t, time.Minute, time.Minute, func(account *MailAccount, passportNumber string) error {
+		return nil
+	})
+	future := p.Submit("E00000001")
+	p.Close()
+	if err := waitFuture(t, future); !errors.Is(err, ErrCheckCanceled) {
+		t.Errorf("error = %v, want ErrCheckCanceled", err)
+	}
+	if err := waitFuture(t, p.Submit("E00000002")); !errors.Is(err, ErrCheckCanceled) {
+		t.Errorf("submit after close: error = %v, want ErrCheckCanceled", err)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/utils"
+	"errors"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+	"net/url"
+)
+
+// assignProxy 为一次查询从代理池中选出代理并绑定到 ctx，整次查询（浏览器和验证码识别）都使用这个代理
+func assignProxy(ctx context.Context) (context.Context, string) {
+	proxy := utils.DefaultProxyPool().Pick()
+	return utils.WithProxy(ctx, proxy), proxy
+}
+
+// reportProxy 根据查询结果更新代理的健康分。
+// 只有网络失败和超时计为代理失败，申请信息错误、验证码错误等说明代理本身可用。
+func reportProxy(proxy string, err error) {
+	switch {
+	case proxy == "" || errors.Is(err, ErrCheckCanceled):
+		return
+	case errors.Is(err, ErrCrawlFailed), errors.Is(err, ErrSelectorTimeout), errors.Is(err, ErrCheckTimeout):
+		utils.DefaultProxyPool().Report(proxy, err)
+	default:
+		utils.DefaultProxyPool().Report(proxy, nil)
+	}
+}
+
+// browserContextProxy 返回为 BrowserContext 设置代理的选项，Chrome 不接受地址中的账号密码，需要单独认证
+func browserContextProxy(proxy string) (chromedp.CreateBrowserContextOption, *url.Userinfo, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, nil, err
+	}
+	user := u.User
+	u.User = nil
+	server := u.String()
+	return func(p *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+		return p.WithProxyServer(server)
+	}, user, nil
+}
+
+// enableProxyAuth 在标签页中拦截请求，遇到代理认证时自动提供账号密码
+func enableProxyAuth(ctx context.Context, user *url.Userinfo) error {
+	password, _ := user.Password()
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *fetch.EventRequestPaused:
+			go chromedp.Run(ctx, fetch.ContinueRequest(ev.RequestID))
+		case *fetch.EventAuthRequired:
+			go chromedp.Run(ctx, fetch.ContinueWithAuth(ev.RequestID, &fetch.AuthChallengeResponse{
+				Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+				Username: user.Username(),
+				Password: password,
+			}))
+		}
+	})
+	return chromedp.Run(ctx, fetch.Enable().WithHandleAuthRequests(true))
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/config"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter 控制访问 CEAC 的频率。Wait 按先来后到排队，轮到时返回，ctx 结束时退回预约并返回 ctx 的错误
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// RateLimitStats 限流器当前状态
+type RateLimitStats struct {
+	PerMinute int           `json:"per_minute"` // 每分钟最多访问次数
+	Jitter    time.Duration `json:"jitter"`     // 每次访问额外随机等待的最长时间
+	Waiting   int           `json:"waiting"`    // 正在排队的查询数
+	Backend   string        `json:"backend"`    // local / redis
+}
+
+// LocalRateLimiter 进程内的限流器，相邻两次访问至少间隔 1 分钟 / perMinute，另加随机抖动
+type LocalRateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	jitter   time.Duration
+	next     time.Time      // 下一个可用的访问时间
+	released map[int64]bool // 已退回但还没从队尾收回的预约时间（UnixNano），见 release
+	waiting  int
+}
+
+// NewLocalRateLimiter 创建进程内限流器，perMinute 小于等于 0 表示不限制
+func NewLocalRateLimiter(perMinute int, jitter time.Duration) *LocalRateLimiter {
+	l := &LocalRateLimiter{jitter: jitter}
+	if perMinute > 0 {
+		l.interval = time.Minute / time.Duration(perMinute)
+	}
+	return l
+}
+
+// reserve 预约下一个访问时间
+func (l *LocalRateLimiter) reserve(now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	at := now
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	return at
+}
+
+// release 退回 ctx 结束前没有用上的预约。位于队尾的预约连同紧挨在它前面、之前已退回的预约一起收回；
+// 队伍中间的预约先记下，等排在后面的预约也退回后再一起收回，避免一批同时超时的查询把后续查询越推越远
+func (l *LocalRateLimiter) release(at time.Time) {
+	if l.interval <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released == nil {
+		l.released = make(map[int64]bool)
+	}
+	l.released[at.UnixNano()] = true
+	for {
+		prev := l.next.Add(-l.interval).UnixNano()
+		if !l.released[prev] {
+			break
+		}
+		delete(l.released, prev)
+		l.next = l.next.Add(-l.interval)
+	}
+	// 已经过去的空档不会再影响排队，不必保留
+	now := time.Now().UnixNano()
+	for released := range l.released {
+		if released < now {
+			delete(l.released, released)
+		}
+	}
+}
+
+func (l *LocalRateLimiter) Wait(ctx context.Context) error {
+	at := l.reserve(time.Now())
+	if err := l.waitUntil(ctx, at); err != nil {
+		l.release(at)
+		return err
+	}
+	return nil
+}
+
+// waitUntil 排队等待到 at，再加上随机抖动
+func (l *LocalRateLimiter) waitUntil(ctx context.Context, at time.Time) error {
+	delay := time.Until(at)
+	if l.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(l.jitter)))
+	}
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	l.waiting++
+	waiting := l.waiting
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+	if delay > time.Second {
+		log.Printf("CEAC 访问限流，等待 %s（排队 %d 个）", delay.Round(time.Millisecond), waiting)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats 返回限流器当前状态
+func (l *LocalRateLimiter) Stats() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := RateLimitStats{Jitter: l.jitter, Waiting: l.waiting, Backend: "local"}
+	if l.interval > 0 {
+		stats.PerMinute = int(time.Minute / l.interval)
+	}
+	return stats
+}
+
+// reserveScript 在 Redis 中原子地预约下一个访问时间，所有实例共用同一个键
+var reserveScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local next = tonumber(redis.call('GET', KEYS[1]) or '0')
+local at = math.max(now, next)
+redis.call('SET', KEYS[1], at + interval, 'PX', at + interval - now + 60000)
+return at
+`)
+
+// releaseScript 退回没有用上的预约，规则与 LocalRateLimiter.release 相同。
+// KEYS[2] 记录已退回但还没从队尾收回的预约时间
+var releaseScript = redis.NewScript(`
+local at = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local next = tonumber(redis.call('GET', KEYS[1]) or '0')
+redis.call('ZADD', KEYS[2], at, ARGV[1])
+while next > 0 do
+	local prev = string.format('%d', next - interval)
+	if not redis.call('ZSCORE', KEYS[2], prev) then
+		break
+	end
+	redis.call('ZREM', KEYS[2], prev)
+	next = next - interval
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[3])
+if next > 0 then
+	local ttl = math.max(next - now, 0) + 60000
+	redis.call('SET', KEYS[1], next, 'PX', ttl)
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return next
+`)
+
+// RedisRateLimiter 多个实例共用的限流器，访问时间由 Redis 统一分配，Redis 不可用时退回进程内限流
+type RedisRateLimiter struct {
+	local  *LocalRateLimiter
+	client *redis.Client
+	key    string
+}
+
+// NewRedisRateLimiter 创建基于 Redis 的限流器
+func NewRedisRateLimiter(client *redis.Client, key string, perMinute int, jitter time.Duration) *RedisRateLimiter {
+	return &RedisRateLimiter{local: NewLocalRateLimiter(perMinute, jitter), client: client, key: key}
+}
+
+func (l *RedisRateLimiter) Wait(ctx context.Context) error {
+	if l.local.interval <= 0 {
+		return l.local.Wait(ctx)
+	}
+	now := time.Now()
+	at, err := reserveScript.Run(ctx, l.client, []string{l.key}, now.UnixMilli(), l.local.interval.Milliseconds()).Int64()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Redis 限流失败，改用进程内限流: %v", err)
+		return l.local.Wait(ctx)
+	}
+	if err := l.local.waitUntil(ctx, time.UnixMilli(at)); err != nil {
+		l.release(at)
+		return err
+	}
+	return nil
+}
+
+// release 退回没有用上的预约。ctx 已经结束，改用独立的超时
+func (l *RedisRateLimiter) release(at int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	keys := []string{l.key, l.key + ":released"}
+	if err := releaseScript.Run(ctx, l.client, keys, at, l.local.interval.Milliseconds(), time.Now().UnixMilli()).Err(); err != nil {
+		log.Printf("Redis 限流退回预约失败: %v", err)
+	}
+}
+
+// Stats 返回限流器当前状态，排队数只包含本实例
+func (l *RedisRateLimiter) Stats() RateLimitStats {
+	stats := l.local.Stats()
+	stats.Backend = "redis"
+	return stats
+}
+
+var (
+	ceacLimiterMu sync.Mutex
+	ceacLimiter   RateLimiter
+)
+
+// CeacRateLimiter 返回所有 CEAC 查询共用的限流器。
+// 每分钟最多访问次数由 CEAC_RATE_PER_MINUTE 配置（默认 6），随机抖动由 CEAC_RATE_JITTER 配置（默认 3 秒），
+// CEAC_RATE_BACKEND=redis 时多个实例通过 Redis 共享限额。
+func CeacRateLimiter() RateLimiter {
+	ceacLimiterMu.Lock()
+	defer ceacLimiterMu.Unlock()
+	if ceacLimiter == nil {
+		perMinute := config.GetEnvInt("CEAC_RATE_PER_MINUTE", 6)
+		jitter := config.GetEnvDuration("CEAC_RATE_JITTER", 3*time.Second)
+		if strings.ToLower(config.GetEnv("CEAC_RATE_BACKEND", "local")) == "redis" {
+			ceacLimiter = NewRedisRateLimiter(config.ConfigureRedis(), "crawler-visa:ceac-rate", perMinute, jitter)
+		} else {
+			ceacLimiter = NewLocalRateLimiter(perMinute, jitter)
+		}
+		log.Printf("CEAC 访问限流: 每分钟 %d 次，随机抖动 %s", perMinute, jitter)
+	}
+	return ceacLimiter
+}
+
+// SetCeacRateLimiter 替换 CEAC 限流器，用于测试或关闭限流
+func SetCeacRateLimiter(limiter RateLimiter) {
+	ceacLimiterMu.Lock()
+	defer ceacLimiterMu.Unlock()
+	ceacLimiter = limiter
+}
+
+// CeacRateLimitStats 返回 CEAC 限流器的状态，限流器不支持统计时返回 nil
+func CeacRateLimitStats() *RateLimitStats {
+	if limiter, ok := CeacRateLimiter().(interface{ Stats() RateLimitStats }); ok {
+		stats := limiter.Stats()
+		return &stats
+	}
+	return nil
+}
+
+// waitCeacTurn 在打开 CEAC 页面前排队，ctx 结束时返回超时或取消错误
+func waitCeacTurn(ctx context.Context) error {
+	if err := CeacRateLimiter().Wait(ctx); err != nil {
+		return contextError(ctx, err)
+	}
+	return nil
+}
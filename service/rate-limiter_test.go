@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestLocalRateLimiterReleasesCanceledSlots 取消的查询退回预约，不再把后面的查询越推越远
+func TestLocalRateLimiterReleasesCanceledSlots(t *testing.T) {
+	limiter := NewLocalRateLimiter(1, 0)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	limiter.mu.Lock()
+	afterFirst := limiter.next
+	limiter.mu.Unlock()
+
+	// 排在后面的查询超时后，下一个访问时间回到第一次访问之后
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait error = %v, want deadline exceeded", err)
+	}
+	limiter.mu.Lock()
+	next := limiter.next
+	limiter.mu.Unlock()
+	if !next.Equal(afterFirst) {
+		t.Fatalf("next after cancel = %s, want %s", next, afterFirst)
+	}
+
+	// 队伍中间的预约先退回，等队尾也退回后一起收回
+	second := limiter.reserve(time.Now())
+	third := limiter.reserve(time.Now())
+	limiter.release(second)
+	limiter.mu.Lock()
+	next = limiter.next
+	limiter.mu.Unlock()
+	if !next.Equal(third.Add(limiter.interval)) {
+		t.Fatalf("next after releasing middle slot = %s, want unchanged %s", next, third.Add(limiter.interval))
+	}
+	limiter.release(third)
+	limiter.mu.Lock()
+	next, released := limiter.next, len(limiter.released)
+	limiter.mu.Unlock()
+	if !next.Equal(afterFirst) || released != 0 {
+		t.Fatalf("next after releasing tail = %s (%d pending), want %s", next, released, afterFirst)
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"crawler-visa/config"
+	"crawler-visa/utils"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// CEAC 页面选择器的键名，对应 selectors.json 中 selectors 的键
+const (
+	SelectorVisaAppType    = "visa_app_type"         // 选择签证类别 NIV / IV
+	SelectorLocation       = "location_dropdown"     // 选择领区
+	SelectorCaseNumber     = "case_number_input"     // 申请预约AA号 / 移民签证案件号
+	SelectorPassportNumber = "passport_number_input" // 护照号
+	SelectorSurname        = "surname_input"         // 姓前5个英文字符
+	SelectorCaptchaInput   = "captcha_input"         // 填写图像验证码
+	SelectorCaptchaImage   = "captcha_image"         // 抓取图像验证码
+	SelectorCaptchaError   = "captcha_error"         // 提交后的报错信息
+	SelectorSubmitButton   = "submit_button"         // 查询提交按钮
+	SelectorStatus         = "status"                // 状态抓取
+	SelectorStatusContent  = "status_content"        // 状态详细信息抓取
+	SelectorSubmitDate     = "submit_date"           // 提交（创建）时间抓取
+	SelectorStatusDate     = "status_date"           // 最后一次更新时间抓取
+	SelectorIvCaseNumber   = "iv_case_number"        // 移民签证结果页的案件号
+	SelectorResultPanel    = "result_panel"          // 结果面板，保存查询证据用，可选
+	SelectorMaintenance    = "maintenance_notice"    // 维护页面的提示区域，可选，只是识别维护的依据之一，见 isMaintenancePage
+)
+
+// defaultMaintenanceSelector 选择器文件未配置 maintenance_notice 时使用的维护提示选择器。
+// 取自仿真站点的维护页面，拿到真实 CEAC 维护页面后应按实际结构更新
+const defaultMaintenanceSelector = ".maintenance"
+
+// requiredSelectorKeys 选择器文件中必须存在的键
+var requiredSelectorKeys = []string{
+	SelectorVisaAppType, SelectorLocation, SelectorCaseNumber, SelectorPassportNumber, SelectorSurname,
+	SelectorCaptchaInput, SelectorCaptchaImage, SelectorCaptchaError, SelectorSubmitButton,
+	SelectorStatus, SelectorStatusContent, SelectorSubmitDate, SelectorStatusDate, SelectorIvCaseNumber,
+}
+
+//go:embed selectors.json
+var builtinSelectors []byte
+
+// SelectorSet 一个版本的 CEAC 页面选择器
+type SelectorSet struct {
+	Version   string            `json:"version"`   // 选择器版本，建议使用 CEAC 页面改版日期
+	Selectors map[string]string `json:"selectors"` // 键名到选择器的映射，只支持 #id、.class、[name] 和 [name=value]
+	Source    string            `json:"source"`    // 加载来源：文件路径或 builtin
+}
+
+// Get 返回指定键的选择器
+func (s *SelectorSet) Get(key string) string {
+	return s.Selectors[key]
+}
+
+// Validate 检查版本号和所有必需的选择器是否存在
+func (s *SelectorSet) Validate() error {
+	if strings.TrimSpace(s.Version) == "" {
+		return errors.New("选择器文件缺少 version")
+	}
+	var missing []string
+	for _, key := range requiredSelectorKeys {
+		if strings.TrimSpace(s.Selectors[key]) == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("选择器文件缺少必需的键: %s", strings.Join(missing, ", "))
+	}
+	// HTTP 查询方式和巡检用 utils.FindElement 解析页面，只支持简单选择器，不能只在浏览器中可用
+	var invalid []string
+	for key, selector := range s.Selectors {
+		if err := utils.ValidateSelector(selector); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("选择器文件包含不支持的选择器: %s", strings.Join(invalid, "; "))
+	}
+	return nil
+}
+
+// parseSelectors 解析并校验选择器文件内容
+func parseSelectors(data []byte, source string) (*SelectorSet, error) {
+	set := &SelectorSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("解析选择器文件 %s 失败: %w", source, err)
+	}
+	set.Source = source
+	if err := set.Validate(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+var currentSelectors atomic.Pointer[SelectorSet]
+
+// defaultSelectorsFile 随代码发布的选择器文件，相对于项目根目录
+const defaultSelectorsFile = "service/selectors.json"
+
+// CurrentSelectors 返回当前生效的选择器，首次调用时从 SELECTORS_FILE 加载，文件不存在时使用内置版本
+func CurrentSelectors() *SelectorSet {
+	if set := currentSelectors.Load(); set != nil {
+		return set
+	}
+	set, err := ReloadSelectors()
+	if err != nil {
+		log.Printf("警告: 加载选择器文件失败，使用编译时内置的选择器，修改选择器文件并重新加载不会生效: %v", err)
+		set, err = parseSelectors(builtinSelectors, "builtin")
+		if err != nil {
+			panic(err) // 内置文件随代码发布，解析失败属于编译期错误
+		}
+		currentSelectors.CompareAndSwap(nil, set)
+	}
+	return currentSelectors.Load()
+}
+
+// ReloadSelectors 重新读取 SELECTORS_FILE（默认 service/selectors.json），校验通过后原子替换当前选择器。
+// 校验失败时保留原有选择器并返回错误，正在进行的查询不受影响。
+func ReloadSelectors() (*SelectorSet, error) {
+	path := config.GetEnv("SELECTORS_FILE", defaultSelectorsFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set, err := parseSelectors(data, path)
+	if err != nil {
+		return nil, err
+	}
+	currentSelectors.Store(set)
+	log.Printf("已加载选择器版本 %s（%s）", set.Version, path)
+	return set, nil
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseSelectorsRejectsUnsupportedSyntax(t *testing.T) {
+	if _, err := parseSelectors(builtinSelectors, "builtin"); err != nil {
+		t.Fatalf("builtin selectors: %v", err)
+	}
+
+	for _, selector := range []string{"select#Location_Dropdown", "div.x span", "#a, #b", "input[type=text]"} {
+		set := &SelectorSet{}
+		if err := json.Unmarshal(builtinSelectors, set); err != nil {
+			t.Fatal(err)
+		}
+		set.Selectors[SelectorLocation] = selector
+		data, _ := json.Marshal(set)
+		_, err := parseSelectors(data, "test")
+		if err == nil || !strings.Contains(err.Error(), SelectorLocation) {
+			t.Errorf("%s: error = %v, want unsupported selector rejected", selector, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"crawler-visa/ceacfake"
+	"crawler-visa/models"
+	"crawler-visa/utils"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/chromedp/chromedp"
+)
+
+// statusCheckFunc 一种查询方式，参数与 performHTTPStatusCheck 相同
+type statusCheckFunc func(ctx context.Context, usStatus *models.QueryUsStatus) (models.UsStatus, error)
+
+// startCeacFake 启动仿真站点并把查询指向它，验证码由返回的假识别器按 answers 依次给出
+func startCeacFake(t *testing.T, answers ...string) (*ceacfake.Server, *utils.FakeCaptchaSolver) {
+	server := ceacfake.NewServer()
+	t.Cleanup(server.Close)
+	t.Setenv("CEAC_BASE_URL", server.URL)
+	t.Setenv("DIAGNOSTICS_ENABLED", "false")
+	t.Setenv("EVIDENCE_ENABLED", "false")
+
+	solver := utils.NewFakeCaptchaSolver(answers...)
+	SetCaptchaSolver(solver)
+	SetCeacRateLimiter(NewLocalRateLimiter(0, 0))
+	t.Cleanup(func() {
+		SetCaptchaSolver(nil)
+		SetCeacRateLimiter(nil)
+	})
+	return server, solver
+}
+
+var (
+	nivQuery = models.QueryUsStatus{Location: "GUZ", ApplicationID: "AA00ABCDEF", PassportNumber: "E12345678", First5LettersOfSurname: "ZHANG"}
+	ivQuery  = models.QueryUsStatus{VisaCategory: models.VisaCategoryIV, CaseNumber: "GUZ2023123456"}
+)
+
+// testStatusCheck 对一种查询方式运行完整的仿真站点查询流程
+func testStatusCheck(t *testing.T, check statusCheckFunc) {
+	t.Run("NIV", func(t *testing.T) {
+		startCeacFake(t, ceacfake.DefaultCaptchaAnswer)
+		query := nivQuery
+		status, err := check(context.Background(), &query)
+		if err != nil {
+			t.Fatalf("check error = %v", err)
+		}
+		if status.Status != "Issued" || status.CanonicalStatus != models.VisaStatusIssued ||
+			status.Created != "03-Jun-2024" || status.LastUpdated != "12-Jun-2024" || status.VisaCategory != models.VisaCategoryNIV {
+			t.Errorf("unexpected status: %+v", status)
+		}
+	})
+
+	t.Run("IV", func(t *testing.T) {
+		startCeacFake(t, ceacfake.DefaultCaptchaAnswer)
+		query := ivQuery
+		status, err := check(context.Background(), &query)
+		if err != nil {
+			t.Fatalf("check error = %v", err)
+		}
+		if status.CanonicalStatus != models.VisaStatusAtNVC || status.CaseNumber != "GUZ2023123456" || status.VisaCategory != models.VisaCategoryIV {
+			t.Errorf("unexpected status: %+v", status)
+		}
+	})
+
+	t.Run("验证码错误后重试", func(t *testing.T) {
+		_, solver := startCeacFake(t, "WRONG", ceacfake.DefaultCaptchaAnswer)
+		query := nivQuery
+		status, err := check(context.Background(), &query)
+		if err != nil {
+			t.Fatalf("check error = %v", err)
+		}
+		if status.CanonicalStatus != models.VisaStatusIssued {
+			t.Errorf("unexpected status: %+v", status)
+		}
+		if solver.Calls() != 2 {
+			t.Errorf("solver calls = %d, want 2", solver.Calls())
+		}
+		if reported := solver.Reported(); len(reported) != 1 || reported[0] != "fake-1" {
+			t.Errorf("reported = %v, want [fake-1]", reported)
+		}
+	})
+
+	t.Run("申请不存在", func(t *testing.T) {
+		_, solver := startCeacFake(t, ceacfake.DefaultCaptchaAnswer)
+		query := nivQuery
+		query.Location = "SHG"
+		_, err := check(context.Background(), &query)
+		if !errors.Is(err, ErrApplicationNotFound) {
+			t.Fatalf("check error = %v, want ErrApplicationNotFound", err)
+		}
+		if solver.Calls() != 1 {
+			t.Errorf("solver calls = %d, want 1", solver.Calls())
+		}
+	})
+
+	t.Run("网站维护", func(t *testing.T) {
+		server, solver := startCeacFake(t, ceacfake.DefaultCaptchaAnswer)
+		server.SetMaintenance(true)
+		query := nivQuery
+		_, err := check(context.Background(), &query)
+		if !errors.Is(err, ErrCeacMaintenance) {
+			t.Fatalf("check error = %v, want ErrCeacMaintenance", err)
+		}
+		if solver.Calls() != 0 {
+			t.Errorf("solver calls = %d, want 0", solver.Calls())
+		}
+	})
+}
+
+func TestHTTPStatusCheck(t *testing.T) {
+	testStatusCheck(t, performHTTPStatusCheck)
+}
+
+// TestChromedpStatusCheck 需要本机安装 Chrome，可通过 BROWSER_EXEC_PATH 指定路径，找不到时跳过
+func TestChromedpStatusCheck(t *testing.T) {
+	execPath := os.Getenv("BROWSER_EXEC_PATH")
+	if execPath == "" {
+		for _, name := range []string{"google-chrome", "chromium", "chromium-browser", "headless-shell"} {
+			if path, err := exec.LookPath(name); err == nil {
+				execPath = path
+				break
+			}
+		}
+	}
+	if execPath == "" {
+		t.Skip("没有找到 Chrome，设置 BROWSER_EXEC_PATH 后运行")
+	}
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(),
+		append(chromedp.DefaultExecAllocatorOptions[:], chromedp.ExecPath(execPath), chromedp.NoSandbox)...)
+	defer cancelAlloc()
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	defer cancelBrowser()
+	if err := chromedp.Run(browserCtx); err != nil {
+		t.Fatalf("启动 Chrome 失败: %v", err)
+	}
+
+	testStatusCheck(t, func(ctx context.Context, usStatus *models.QueryUsStatus) (models.UsStatus, error) {
+		tabCtx, cancel := chromedp.NewContext(browserCtx) // 每次查询使用新的标签页
+		defer cancel()
+		return performVisaStatusCheck(tabCtx, usStatus)
+	})
+}
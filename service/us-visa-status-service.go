@@ -2,268 +2,240 @@ package service
 
 import (
 	"context"
+	"crawler-visa/config"
 	"crawler-visa/models"
 	"crawler-visa/utils"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/chromedp/chromedp"
-	"github.com/emersion/go-imap"
-	imapID "github.com/emersion/go-imap-id"
-	"github.com/emersion/go-imap/client"
-	"github.com/emersion/go-message/mail"
-	"github.com/joho/godotenv"
-	"gopkg.in/gomail.v2"
-	"io/ioutil"
 	"log"
-	"os"
-	"os/exec"
 	"strings"
 	"time"
 )
 
-const (
-	visaAppTypeSelector = `#Visa_Application_Type`                                           // 选择非移民签证
-	locationDropdown    = `#Location_Dropdown`                                               // 选择领区
-	caseNumberInput     = `#Visa_Case_Number`                                                // 申请预约AA号
-	passportNumberInput = `#Passport_Number`                                                 // 护照号
-	surnameInput        = `#Surname`                                                         // 姓前5个英文字符
-	captchaInput        = `#Captcha`                                                         // 填写图像验证码
-	statusTranslation   = `#ctl00_ContentPlaceHolder1_ucApplicationStatusView_pTranslation`  // 已废弃 状态详细信息抓取
-	statusMessage       = `#ctl00_ContentPlaceHolder1_ucApplicationStatusView_lblMessage`    // 已废弃 状态详细信息抓取
-	status              = ".status"                                                          // 状态抓取
-	statusContent       = `.ceac-status-content`                                             // 状态详细信息抓取
-	submitDate          = `#ctl00_ContentPlaceHolder1_ucApplicationStatusView_lblSubmitDate` // 提交（创建）时间抓取
-	statusDate          = `#ctl00_ContentPlaceHolder1_ucApplicationStatusView_lblStatusDate` // 最后一次更新时间抓取
-	captchaImage        = `#c_status_ctl00_contentplaceholder1_defaultcaptcha_CaptchaImage`  // 抓取图像验证码
-	captchaError        = `#ctl00_ContentPlaceHolder1_lblError`                              // 图像验证码提交错误后的报错信息
-	folderButton        = `#ctl00_ContentPlaceHolder1_imgFolder`                             // 查询提交按钮
-)
+// RunVisaStatusCheck 执行签证状态查询，查询方式由 CEAC_BACKEND 决定：
+// chromedp（默认）从共用的浏览器池借出一个浏览器操作页面，http 直接提交表单而不启动浏览器。
+// 整个查询受 CHECK_TIMEOUT（默认 3 分钟）限制，ctx 被取消或超时后立即中断页面操作并关闭标签页。
+// 配置了代理池（PROXY_POOL）时，每次查询固定使用一个代理，并根据查询结果更新代理的健康分。
+func RunVisaStatusCheck(ctx context.Context, usStatus *models.QueryUsStatus) (statusCheck models.UsStatus, err error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetEnvDuration("CHECK_TIMEOUT", 3*time.Minute))
+	defer cancel()
+	ctx, proxy := assignProxy(ctx)
+	defer func() {
+		reportProxy(proxy, err)
+	}()
 
-func RunVisaStatusCheck(usStatus *models.QueryUsStatus) (models.UsStatus, error) {
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.DisableGPU,
-		chromedp.Flag("headless", false), // 是否启用无头模式
-		chromedp.WindowSize(1920, 1080),  // 设置屏幕分辨率
-	)
+	switch backend := statusBackend(); backend {
+	case BackendHTTP:
+		return runHTTPStatusCheck(ctx, usStatus)
+	case BackendChromedp:
+	default:
+		return models.UsStatus{}, fmt.Errorf("未知的 CEAC_BACKEND: %s", backend)
+	}
 
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancel()
-	taskCtx, cancel := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
-	defer cancel()
+	pool, err := DefaultBrowserPool()
+	if err != nil {
+		return models.UsStatus{}, err
+	}
+	lease, err := pool.Acquire(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return models.UsStatus{}, contextError(ctx, err)
+		}
+		return models.UsStatus{}, &CrawlError{Kind: ErrBrowserCrashed, Detail: "启动浏览器失败", Cause: err}
+	}
+	defer lease.Release()
+
+	taskCtx, cancelTask := context.WithCancel(utils.WithProxy(lease.Ctx, proxy)) // 验证码识别也使用同一个代理
+	defer cancelTask()
+	stop := context.AfterFunc(ctx, cancelTask) // 超时或调用方取消时中断正在执行的页面操作
+	defer stop()
 
-	statusCheck, err := performVisaStatusCheck(taskCtx, usStatus)
+	statusCheck, err = performVisaStatusCheck(taskCtx, usStatus)
 	if err != nil {
+		if ctx.Err() != nil {
+			lease.Discard() // 超时的浏览器可能已卡死，回收后重建
+			return models.UsStatus{}, contextError(ctx, err)
+		}
 		return models.UsStatus{}, err
 	}
 
 	return statusCheck, nil
 }
 
+// runStep 在 STEP_TIMEOUT（默认 30 秒）内执行一组页面操作，并对失败原因分类
+func runStep(ctx context.Context, step string, actions ...chromedp.Action) error {
+	stepCtx, cancel := context.WithTimeout(ctx, config.GetEnvDuration("STEP_TIMEOUT", 30*time.Second))
+	defer cancel()
+	start := time.Now()
+	err := classifyBrowserError(ctx, chromedp.Run(stepCtx, actions...), step)
+	crawlTraceFrom(ctx).recordStep(step, start, err)
+	return err
+}
+
 func performVisaStatusCheck(taskCtx context.Context, usStatus *models.QueryUsStatus) (models.UsStatus, error) {
-	log.Printf("Performing visa status check, Location: %s, Application ID: %s, Passport Number: %s, Surname Initials: %s\n",
-		usStatus.Location, usStatus.ApplicationID, usStatus.PassportNumber, usStatus.First5LettersOfSurname)
+	log.Printf("Performing visa status check, Category: %s, Location: %s, Application ID: %s, Case Number: %s, Passport Number: %s, Surname Initials: %s\n",
+		usStatus.Category(), usStatus.Location, usStatus.ApplicationID, usStatus.CaseNumber, usStatus.PassportNumber, usStatus.First5LettersOfSurname)
 	var usStatusResult models.UsStatus
 
-	if err := godotenv.Load(".env"); err != nil {
-		return usStatusResult, fmt.Errorf("error loading .env file: %w", err)
+	if err := usStatus.Validate(); err != nil {
+		return usStatusResult, &CrawlError{Kind: ErrInvalidQuery, Cause: err}
+	}
+
+	solver, err := getCaptchaSolver()
+	if err != nil {
+		return usStatusResult, &CrawlError{Kind: ErrCaptchaSolverUnavailable, Cause: err}
 	}
 
-	client := utils.NewChaoJiYing(1*time.Minute, "")
+	sel := CurrentSelectors() // 同一次查询始终使用同一版本的选择器
+	taskCtx, trace := withCrawlTrace(taskCtx)
+	trace.listenConsole(taskCtx)
+	// fail 在返回或重试前保存诊断包
+	fail := func(err error) error {
+		saveDiagnostics(taskCtx, usStatus, BackendChromedp, sel, err)
+		return err
+	}
 
 	maxAttempts := 3
+	var lastErr error
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		log.Printf("开始第 %d 签证状态查询表单", attempt)
-		var imageBuf []byte
-		if err := chromedp.Run(taskCtx,
-			chromedp.Navigate("https://ceac.state.gov/CEACStatTracker/Status.aspx"),
-			chromedp.WaitVisible(visaAppTypeSelector, chromedp.ByID),
-			chromedp.SetValue(visaAppTypeSelector, `NIV`, chromedp.ByID),
-			// 领区
-			chromedp.WaitVisible(locationDropdown, chromedp.ByID),
-			chromedp.SetValue(locationDropdown, usStatus.Location, chromedp.ByID),
-			// 申请号
-			chromedp.WaitVisible(caseNumberInput, chromedp.ByID),
-			chromedp.SetValue(caseNumberInput, usStatus.ApplicationID, chromedp.ByID),
-			// 护照号
-			chromedp.WaitVisible(passportNumberInput, chromedp.ByID),
-			chromedp.SetValue(passportNumberInput, usStatus.PassportNumber, chromedp.ByID),
-			// 姓氏首字母 前五个字母
-			chromedp.WaitVisible(surnameInput, chromedp.ByID),
-			chromedp.SetValue(surnameInput, usStatus.First5LettersOfSurname, chromedp.ByID),
-			// 拿到验证码图片
-			chromedp.WaitVisible(captchaImage, chromedp.ByQuery),
-			chromedp.Screenshot(captchaImage, &imageBuf, chromedp.NodeVisible),
-		); err != nil {
+		trace.setAttempt(attempt)
+		if err := waitCeacTurn(taskCtx); err != nil {
 			return usStatusResult, err
 		}
+		var page string
+		if err := runStep(taskCtx, "打开查询页面",
+			chromedp.Navigate(ceacStatusURL()),
+			chromedp.OuterHTML("html", &page, chromedp.ByQuery),
+		); err != nil {
+			return usStatusResult, fail(err)
+		}
+		if isMaintenancePage(page, sel) {
+			return usStatusResult, fail(&CrawlError{Kind: ErrCeacMaintenance})
+		}
 
-		log.Println("开始识别验证码")
-		if err := ioutil.WriteFile("captcha.png", imageBuf, 0644); err != nil {
-			return usStatusResult, err
+		var imageBuf []byte
+		actions := append(queryFormActions(sel, usStatus),
+			// 拿到验证码图片
+			chromedp.WaitVisible(sel.Get(SelectorCaptchaImage), chromedp.ByQuery),
+			chromedp.Screenshot(sel.Get(SelectorCaptchaImage), &imageBuf, chromedp.NodeVisible),
+		)
+		if err := runStep(taskCtx, "填写查询表单", actions...); err != nil {
+			return usStatusResult, fail(err)
 		}
 
-		var result models.ChaoJiYing
-		response, err := client.GetPicVal(
-			os.Getenv("CJY_USERNAME"),
-			os.Getenv("CJY_PASSWORD"),
-			os.Getenv("CJY_SOFT_ID"),
-			os.Getenv("CJY_CODE_TYPE"),
-			os.Getenv("CJY_MIN_LEN"),
-			"captcha.png")
+		log.Println("开始识别验证码")
+		result, err := solver.Solve(taskCtx, imageBuf)
 		if err != nil {
 			log.Printf("第 %d 次验证码识别失败: %v", attempt, err)
+			lastErr = fail(&CrawlError{Kind: ErrCaptchaSolverUnavailable, Cause: err})
 			continue // 识别失败，重新尝试
 		}
-		if err := json.Unmarshal(response, &result); err != nil {
-			log.Printf("第 %d 次验证码响应解析失败: %v", attempt, err)
-			continue // 解析失败，重新尝试
-		}
-		log.Println("验证码识别结果:", result)
+		log.Printf("验证码识别结果: %s (识别器: %s, 凭证: %s)", result.Answer, result.Solver, result.Ticket)
 
-		if err := chromedp.Run(taskCtx,
-			chromedp.WaitVisible(captchaInput, chromedp.ByID),
-			chromedp.SetValue(captchaInput, result.PicStr, chromedp.ByID),
-			chromedp.Click(folderButton, chromedp.ByID),
+		var pageError string
+		if err := runStep(taskCtx, "提交验证码",
+			chromedp.WaitVisible(sel.Get(SelectorCaptchaInput), chromedp.ByQuery),
+			chromedp.SetValue(sel.Get(SelectorCaptchaInput), result.Answer, chromedp.ByQuery),
+			chromedp.Click(sel.Get(SelectorSubmitButton), chromedp.ByQuery),
 			chromedp.Sleep(2*time.Second), // 等待验证码提交后的响应
-			chromedp.Text(captchaError, &usStatusResult.StatusContent, chromedp.ByID),
+			chromedp.Text(sel.Get(SelectorCaptchaError), &pageError, chromedp.ByQuery),
 		); err != nil {
 			log.Printf("第 %d 次提交验证码失败: %v", attempt, err)
+			lastErr = fail(err)
 			continue // 提交失败，重新尝试
 		}
-		if strings.TrimSpace(usStatusResult.StatusContent) != "" {
-			log.Printf("第 %d 次验证码提交失败，错误信息: %s", attempt, usStatusResult.StatusContent)
+		if strings.TrimSpace(pageError) != "" {
+			log.Printf("第 %d 次验证码提交失败，错误信息: %s", attempt, pageError)
+			lastErr = fail(classifyPageError(pageError))
+			if !errors.Is(lastErr, ErrCaptchaRejected) {
+				return usStatusResult, lastErr // 申请信息有误，重试无意义
+			}
+			reportRejectedCaptcha(taskCtx, solver, result)
 			continue // 验证码提交失败，重新尝试
 		}
 
-		if err := chromedp.Run(taskCtx,
-			chromedp.WaitVisible(statusContent, chromedp.ByQuery),
-			chromedp.Text(statusContent, &usStatusResult.StatusContent, chromedp.NodeVisible),
-			chromedp.Text(status, &usStatusResult.Status, chromedp.NodeVisible),
-			chromedp.Text(submitDate, &usStatusResult.Created, chromedp.NodeVisible),
-			chromedp.Text(statusDate, &usStatusResult.LastUpdated, chromedp.NodeVisible),
-		); err != nil {
+		if err := runStep(taskCtx, "读取查询结果", resultActions(sel, usStatus, &usStatusResult)...); err != nil {
 			log.Printf("第 %d 次获取签证状态信息失败: %v", attempt, err)
+			lastErr = fail(err)
 			continue // 获取状态信息失败，重新尝试
 		}
+		usStatusResult.VisaCategory = usStatus.Category()
+		usStatusResult.CanonicalStatus = models.ParseVisaStatus(usStatusResult.Status)
+		archiveEvidence(usStatus, BackendChromedp, &usStatusResult, captureEvidence(taskCtx, sel))
 
 		return usStatusResult, nil
 
 	}
-	return usStatusResult, fmt.Errorf("验证码识别失败超过最大尝试次数 %d 次", maxAttempts)
+	return usStatusResult, fmt.Errorf("验证码识别失败超过最大尝试次数 %d 次: %w", maxAttempts, lastErr)
 }
 
-func RunVisaEmailTracking(usStatus *models.QueryUsStatus) (models.UsStatus, error) {
-	var usStatusResult models.UsStatus
-
-	msg := gomail.NewMessage()
-	msg.SetHeader("From", "wuaivisa008@163.com")
-	msg.SetHeader("To", "passportstatus@ustraveldocs.com")
-	msg.SetHeader("Subject", usStatus.PassportNumber)
-	msg.SetBody("text/html", usStatus.PassportNumber)
-	n := gomail.NewDialer("smtp.163.com", 465, "wuaivisa008@163.com", "FKKOIOXQCFCRWHFH")
-	if err := n.DialAndSend(msg); err != nil {
-		log.Printf("发送失败")
-	} else {
-		log.Println("发送成功")
+// queryFormActions 按签证类别填写查询表单。
+// NIV 需要领区、AA 申请号、护照号和姓氏前五个字母；IV 只需要案件号。
+func queryFormActions(sel *SelectorSet, usStatus *models.QueryUsStatus) []chromedp.Action {
+	actions := []chromedp.Action{
+		chromedp.WaitVisible(sel.Get(SelectorVisaAppType), chromedp.ByQuery),
+		chromedp.SetValue(sel.Get(SelectorVisaAppType), usStatus.Category(), chromedp.ByQuery),
 	}
-	time.Sleep(25 * time.Second)
-
-	c, err := client.DialTLS("imap.163.com:993", nil)
-	if err != nil {
-		return usStatusResult, err
+	if usStatus.Category() == models.VisaCategoryIV {
+		return append(actions,
+			// 案件号
+			chromedp.WaitVisible(sel.Get(SelectorCaseNumber), chromedp.ByQuery),
+			chromedp.SetValue(sel.Get(SelectorCaseNumber), usStatus.CaseNumber, chromedp.ByQuery),
+		)
 	}
+	return append(actions,
+		// 领区
+		chromedp.WaitVisible(sel.Get(SelectorLocation), chromedp.ByQuery),
+		chromedp.SetValue(sel.Get(SelectorLocation), usStatus.Location, chromedp.ByQuery),
+		// 申请号
+		chromedp.WaitVisible(sel.Get(SelectorCaseNumber), chromedp.ByQuery),
+		chromedp.SetValue(sel.Get(SelectorCaseNumber), usStatus.ApplicationID, chromedp.ByQuery),
+		// 护照号
+		chromedp.WaitVisible(sel.Get(SelectorPassportNumber), chromedp.ByQuery),
+		chromedp.SetValue(sel.Get(SelectorPassportNumber), usStatus.PassportNumber, chromedp.ByQuery),
+		// 姓氏首字母 前五个字母
+		chromedp.WaitVisible(sel.Get(SelectorSurname), chromedp.ByQuery),
+		chromedp.SetValue(sel.Get(SelectorSurname), usStatus.First5LettersOfSurname, chromedp.ByQuery),
+	)
+}
 
-	// 不要忘记退出
-	defer c.Logout()
-
-	// 登录
-	if err := c.Login("wuaivisa008@163.com", "FKKOIOXQCFCRWHFH"); err != nil {
-		return usStatusResult, err
-
-	}
-	log.Println("登录")
-
-	// 设置客户端ID
-	_, err = imapID.NewClient(c).ID(imapID.ID{
-		imapID.FieldName:    "IMAPClient",
-		imapID.FieldVersion: "3.1.0",
-	})
-	if err != nil {
-		return usStatusResult, err
+// captureEvidence 截取结果页整页截图和结果面板的 HTML，截取失败时返回已截取到的部分
+func captureEvidence(ctx context.Context, sel *SelectorSet) map[string][]byte {
+	if !config.GetEnvBool("EVIDENCE_ENABLED", true) {
+		return nil
 	}
-
-	// 选择收件箱
-	mbox, err := c.Select("INBOX", false)
-	if err != nil {
-		return usStatusResult, err
+	panel := sel.Get(SelectorResultPanel)
+	if panel == "" {
+		panel = "body" // 选择器文件未配置结果面板时保存整个页面
 	}
-	seqset := new(imap.SeqSet)
-	seqset.AddNum(mbox.Messages)
-
-	messages := make(chan *imap.Message, 1)
-	done := make(chan error, 1)
-	go func() {
-		done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchEnvelope, "BODY[]"}, messages)
-	}()
-
-	// 读取并打印邮件标题和内容
-	msgEmail := <-messages
-	if msg != nil {
-		log.Println("标题:", msgEmail.Envelope.Subject)
-		if body := msgEmail.GetBody(&imap.BodySectionName{}); body != nil {
-			bodyBytes, _ := ioutil.ReadAll(body)
-			content := string(bodyBytes)
-			r := strings.NewReader(content)
-			mr, err := mail.CreateReader(r)
-			if err != nil {
-				panic(err)
-			}
-			header := mr.Header
-			if received, err := header.Date(); err == nil {
-				loc, err := time.LoadLocation("Asia/Beijing")
-				if err != nil {
-					fmt.Println("加载时区失败, 使用 UTC 时区:", err)
-					loc = time.UTC
-				}
-				receivedInGMT8 := received.In(loc)
-				fmt.Println("收件时间:", receivedInGMT8)
-			} else {
-				fmt.Println("读取邮件时间失败:", err)
-			}
-			// 打印邮件正文
-			for {
-				p, err := mr.NextPart()
-				if err != nil {
-					break
-				}
-
-				switch p.Header.(type) {
-				case *mail.InlineHeader:
-					// 处理内联部分
-					b, _ := ioutil.ReadAll(p.Body)
-					fmt.Println("正文:", string(b))
-					usStatusResult.StatusContent = string(b)
-				case *mail.AttachmentHeader:
-					// 忽略附件
-					continue
-				}
-			}
-		}
-	} else {
-		log.Println("没有消息")
+	var screenshot []byte
+	var outerHTML string
+	if err := runStep(ctx, "保存查询证据",
+		chromedp.FullScreenshot(&screenshot, 80),
+		// 结果面板不存在时退回整个页面，避免等待到超时
+		chromedp.Evaluate(fmt.Sprintf(`(document.querySelector(%q) || document.documentElement).outerHTML`, panel), &outerHTML),
+	); err != nil {
+		log.Printf("截取查询证据失败: %v", err)
 	}
-	if err := <-done; err != nil {
-		return usStatusResult, err
+	return map[string][]byte{
+		EvidenceResultHTML: []byte(outerHTML),
+		EvidenceScreenshot: screenshot,
 	}
-	return usStatusResult, err
-
 }
 
-func CloseAllBrowsers() error {
-	cmd := exec.Command("taskkill", "/F", "/IM", "chrome.exe")
-	if err := cmd.Run(); err != nil {
-		return err
+// resultActions 抓取结果页信息，IV 结果页额外包含案件号
+func resultActions(sel *SelectorSet, usStatus *models.QueryUsStatus, result *models.UsStatus) []chromedp.Action {
+	actions := []chromedp.Action{
+		chromedp.WaitVisible(sel.Get(SelectorStatusContent), chromedp.ByQuery),
+		chromedp.Text(sel.Get(SelectorStatusContent), &result.StatusContent, chromedp.NodeVisible),
+		chromedp.Text(sel.Get(SelectorStatus), &result.Status, chromedp.NodeVisible),
+		chromedp.Text(sel.Get(SelectorSubmitDate), &result.Created, chromedp.NodeVisible),
+		chromedp.Text(sel.Get(SelectorStatusDate), &result.LastUpdated, chromedp.NodeVisible),
+	}
+	if usStatus.Category() == models.VisaCategoryIV {
+		actions = append(actions, chromedp.Text(sel.Get(SelectorIvCaseNumber), &result.CaseNumber, chromedp.NodeVisible))
 	}
-	log.Println("所有浏览器已关闭")
-	return nil
+	return actions
 }
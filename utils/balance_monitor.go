@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// BalanceSnapshot 记录一次打码平台余额查询的结果。
+type BalanceSnapshot struct {
+	Solver    string    `json:"solver"`          // 识别器名称
+	Points    int       `json:"points"`          // 剩余点数
+	Threshold int       `json:"threshold"`       // 告警阈值
+	Low       bool      `json:"low"`             // 是否低于告警阈值
+	Error     string    `json:"error,omitempty"` // 查询失败时的错误信息
+	CheckedAt time.Time `json:"checked_at"`      // 查询时间
+}
+
+// BalanceMonitor 保存各识别器最近一次的余额，并判断是否需要发出低余额告警。
+// 余额从正常跌破阈值时只告警一次，恢复到阈值以上后才会再次告警。
+type BalanceMonitor struct {
+	Threshold int // 低于该点数时告警
+
+	mu      sync.Mutex
+	latest  map[string]BalanceSnapshot
+	alerted map[string]bool
+}
+
+// NewBalanceMonitor 创建余额监控器。
+// 参数:
+//
+//	threshold int - 低余额告警阈值。
+//
+// 返回值:
+//
+//	*BalanceMonitor - 新创建的余额监控器实例。
+func NewBalanceMonitor(threshold int) *BalanceMonitor {
+	return &BalanceMonitor{
+		Threshold: threshold,
+		latest:    make(map[string]BalanceSnapshot),
+		alerted:   make(map[string]bool),
+	}
+}
+
+// Update 记录一次余额查询结果。
+// 查询失败时保留上一次的点数，只更新错误信息。
+//
+// 返回值:
+//
+//	BalanceSnapshot - 记录后的快照。
+//	bool - 是否需要发出低余额告警。
+func (m *BalanceMonitor) Update(solver string, points int, err error) (BalanceSnapshot, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.record(solver, points, err)
+	if err != nil {
+		return snapshot, false
+	}
+	if !snapshot.Low {
+		m.alerted[solver] = false
+		return snapshot, false
+	}
+	if m.alerted[solver] {
+		return snapshot, false
+	}
+	m.alerted[solver] = true
+	return snapshot, true
+}
+
+// Record 记录一次余额查询结果但不改变告警状态，用于手动刷新，低余额告警仍由 Update 的调用方发出
+func (m *BalanceMonitor) Record(solver string, points int, err error) BalanceSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.record(solver, points, err)
+}
+
+func (m *BalanceMonitor) record(solver string, points int, err error) BalanceSnapshot {
+	snapshot := m.latest[solver]
+	snapshot.Solver = solver
+	snapshot.Threshold = m.Threshold
+	snapshot.CheckedAt = time.Now()
+	if err != nil {
+		snapshot.Error = err.Error()
+		m.latest[solver] = snapshot
+		return snapshot
+	}
+	snapshot.Error = ""
+	snapshot.Points = points
+	snapshot.Low = points < m.Threshold
+	m.latest[solver] = snapshot
+	return snapshot
+}
+
+// Snapshots 返回所有识别器最近一次的余额，按名称排序
+func (m *BalanceMonitor) Snapshots() []BalanceSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshots := make([]BalanceSnapshot, 0, len(m.latest))
+	for _, snapshot := range m.latest {
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Solver < snapshots[j].Solver })
+	return snapshots
+}
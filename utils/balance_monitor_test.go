@@ -0,0 +1,24 @@
+package utils
+
+import "testing"
+
+func TestBalanceMonitorRecordKeepsAlert(t *testing.T) {
+	m := NewBalanceMonitor(100)
+
+	// 手动刷新发现余额不足，不消耗告警
+	if snapshot := m.Record("chaojiying", 50, nil); !snapshot.Low {
+		t.Errorf("Record() = %+v, want low", snapshot)
+	}
+	if _, alert := m.Update("chaojiying", 50, nil); !alert {
+		t.Error("Update() after Record: alert = false, want true")
+	}
+	if _, alert := m.Update("chaojiying", 40, nil); alert {
+		t.Error("second Update(): alert = true, want only one alert")
+	}
+
+	// 恢复后再次跌破阈值时重新告警
+	m.Update("chaojiying", 500, nil)
+	if _, alert := m.Update("chaojiying", 10, nil); !alert {
+		t.Error("Update() after recovery: alert = false, want true")
+	}
+}
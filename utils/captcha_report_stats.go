@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// CaptchaReportCount 记录某一天的验证码报错情况。
+type CaptchaReportCount struct {
+	Date     string `json:"date"`     // 日期，格式为 2006-01-02
+	Reported int    `json:"reported"` // 报错次数
+	Refunded int    `json:"refunded"` // 平台确认退分的次数
+}
+
+// CaptchaReportStats 按天统计验证码报错与退分次数，并发安全。
+type CaptchaReportStats struct {
+	mu       sync.Mutex
+	days     map[string]*CaptchaReportCount
+	keepDays int
+}
+
+// NewCaptchaReportStats 创建统计器，只保留最近 keepDays 天的数据。
+// 参数:
+//
+//	keepDays int - 保留的天数，小于等于 0 时不清理历史数据。
+//
+// 返回值:
+//
+//	*CaptchaReportStats - 新创建的统计器实例。
+func NewCaptchaReportStats(keepDays int) *CaptchaReportStats {
+	return &CaptchaReportStats{days: make(map[string]*CaptchaReportCount), keepDays: keepDays}
+}
+
+// Record 记录一次报错，refunded 表示平台是否确认退分。
+func (s *CaptchaReportStats) Record(refunded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	date := time.Now().Format("2006-01-02")
+	count, ok := s.days[date]
+	if !ok {
+		count = &CaptchaReportCount{Date: date}
+		s.days[date] = count
+		s.prune()
+	}
+	count.Reported++
+	if refunded {
+		count.Refunded++
+	}
+}
+
+// Today 返回当天的统计数据
+func (s *CaptchaReportStats) Today() CaptchaReportCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	date := time.Now().Format("2006-01-02")
+	if count, ok := s.days[date]; ok {
+		return *count
+	}
+	return CaptchaReportCount{Date: date}
+}
+
+// History 返回按日期升序排列的全部统计数据
+func (s *CaptchaReportStats) History() []CaptchaReportCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := make([]CaptchaReportCount, 0, len(s.days))
+	for _, count := range s.days {
+		history = append(history, *count)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].Date < history[j].Date })
+	return history
+}
+
+// prune 删除超出保留天数的数据，调用方需持有锁
+func (s *CaptchaReportStats) prune() {
+	if s.keepDays <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.keepDays).Format("2006-01-02")
+	for date := range s.days {
+		if date < cutoff {
+			delete(s.days, date)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"context"
+	"crawler-visa/config"
+	"crawler-visa/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CaptchaResult 定义了一次验证码识别的结果。
+type CaptchaResult struct {
+	Answer string // 识别出的验证码文本
+	Ticket string // 打码平台返回的识别凭证（如超级鹰的 pic_id），用于后续报错退分
+	Solver string // 给出该结果的识别器名称
+}
+
+// CaptchaSolver 定义了图像验证码识别器的统一接口。
+// 不同的打码平台（超级鹰等）或测试用的假识别器都实现该接口，
+// 业务代码只依赖接口，便于切换供应商或在某个平台不可用时自动切换。
+type CaptchaSolver interface {
+	// Name 返回识别器名称，用于日志和配置。
+	Name() string
+	// Solve 识别图片数据并返回识别结果。
+	Solve(ctx context.Context, image []byte) (CaptchaResult, error)
+}
+
+// CaptchaReporter 由支持报错退分的识别器实现。
+// 当目标网站拒绝识别结果时，调用方通过该接口把识别凭证报告给打码平台。
+type CaptchaReporter interface {
+	// ReportError 报告识别错误，返回 true 表示平台已受理并退还题分。
+	ReportError(ctx context.Context, result CaptchaResult) (bool, error)
+}
+
+// CaptchaBalanceChecker 由支持查询账户余额的识别器实现。
+type CaptchaBalanceChecker interface {
+	// Balance 返回账户剩余可用点数。
+	Balance(ctx context.Context) (int, error)
+}
+
+// CaptchaSolverFactory 根据环境配置创建识别器。
+type CaptchaSolverFactory func() (CaptchaSolver, error)
+
+var (
+	solverFactoriesMu sync.RWMutex
+	solverFactories   = map[string]CaptchaSolverFactory{
+		"chaojiying": func() (CaptchaSolver, error) { return NewChaoJiYingSolverFromEnv() },
+	}
+)
+
+// RegisterCaptchaSolver 注册一个新的识别器工厂，注册后即可在 CAPTCHA_SOLVERS 中按名称引用。
+// 假识别器不在默认注册表中，只能由测试或离线仿真环境（见 ceacfake 包）显式注册。
+func RegisterCaptchaSolver(name string, factory CaptchaSolverFactory) {
+	solverFactoriesMu.Lock()
+	defer solverFactoriesMu.Unlock()
+	solverFactories[strings.ToLower(name)] = factory
+}
+
+// NewCaptchaSolverFromEnv 按 CAPTCHA_SOLVERS 配置（逗号分隔，按顺序回退）构建识别器链。
+// 未配置时默认只使用超级鹰。
+//
+// 示例（backup 为通过 RegisterCaptchaSolver 注册的备用识别器）:
+//
+//	CAPTCHA_SOLVERS=chaojiying,backup
+func NewCaptchaSolverFromEnv() (CaptchaSolver, error) {
+	names := config.GetEnvList("CAPTCHA_SOLVERS", []string{"chaojiying"})
+
+	solverFactoriesMu.RLock()
+	defer solverFactoriesMu.RUnlock()
+
+	var solvers []CaptchaSolver
+	for _, name := range names {
+		factory, ok := solverFactories[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("未知的验证码识别器: %s", name)
+		}
+		solver, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("初始化验证码识别器 %s 失败: %w", name, err)
+		}
+		solvers = append(solvers, solver)
+	}
+	return NewCaptchaSolverChain(solvers...), nil
+}
+
+// CaptchaSolverChain 按顺序尝试多个识别器，返回第一个成功的结果。
+type CaptchaSolverChain struct {
+	solvers []CaptchaSolver
+}
+
+// NewCaptchaSolverChain 创建识别器链，solvers 的顺序即回退顺序。
+func NewCaptchaSolverChain(solvers ...CaptchaSolver) *CaptchaSolverChain {
+	return &CaptchaSolverChain{solvers: solvers}
+}
+
+// Name 返回链中所有识别器的名称
+func (c *CaptchaSolverChain) Name() string {
+	names := make([]string, 0, len(c.solvers))
+	for _, solver := range c.solvers {
+		names = append(names, solver.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Solve 依次调用链中的识别器，全部失败时返回合并后的错误
+func (c *CaptchaSolverChain) Solve(ctx context.Context, image []byte) (CaptchaResult, error) {
+	if len(c.solvers) == 0 {
+		return CaptchaResult{}, errors.New("没有可用的验证码识别器")
+	}
+	var errs []error
+	for _, solver := range c.solvers {
+		result, err := solver.Solve(ctx, image)
+		if err == nil {
+			return result, nil
+		}
+		log.Printf("验证码识别器 %s 识别失败: %v", solver.Name(), err)
+		errs = append(errs, fmt.Errorf("%s: %w", solver.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return CaptchaResult{}, errors.Join(errs...)
+}
+
+// Solvers 返回链中的识别器，顺序与回退顺序一致
+func (c *CaptchaSolverChain) Solvers() []CaptchaSolver {
+	return append([]CaptchaSolver(nil), c.solvers...)
+}
+
+// ReportError 将报错转交给给出该结果的识别器，识别器不支持报错时返回 false
+func (c *CaptchaSolverChain) ReportError(ctx context.Context, result CaptchaResult) (bool, error) {
+	for _, solver := range c.solvers {
+		if solver.Name() != result.Solver {
+			continue
+		}
+		if reporter, ok := solver.(CaptchaReporter); ok {
+			return reporter.ReportError(ctx, result)
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("识别器 %s 不在当前识别器链中", result.Solver)
+}
+
+// ChaoJiYingSolver 基于超级鹰打码平台的识别器实现。
+type ChaoJiYingSolver struct {
+	Client   *ChaoJiYing
+	User     string
+	Pass     string
+	SoftID   string
+	CodeType string
+	MinLen   string
+}
+
+// NewChaoJiYingSolverFromEnv 使用 CJY_* 环境变量创建超级鹰识别器。
+func NewChaoJiYingSolverFromEnv() (*ChaoJiYingSolver, error) {
+	user := config.GetEnv("CJY_USERNAME", "")
+	if user == "" {
+		return nil, errors.New("未配置 CJY_USERNAME")
+	}
+	client := NewChaoJiYing(config.GetEnvDuration("CJY_TIMEOUT", 1*time.Minute), config.GetEnv("CJY_HTTPS_PROXY", ""))
+	client.Proxies = DefaultProxyPool() // 未配置 CJY_HTTPS_PROXY 时与浏览器共用代理池
+	return &ChaoJiYingSolver{
+		Client:   client,
+		User:     user,
+		Pass:     config.GetEnv("CJY_PASSWORD", ""),
+		SoftID:   config.GetEnv("CJY_SOFT_ID", ""),
+		CodeType: config.GetEnv("CJY_CODE_TYPE", ""),
+		MinLen:   config.GetEnv("CJY_MIN_LEN", ""),
+	}, nil
+}
+
+// Name 返回识别器名称
+func (s *ChaoJiYingSolver) Name() string {
+	return "chaojiying"
+}
+
+// Solve 调用超级鹰接口识别验证码，pic_id 作为识别凭证返回
+func (s *ChaoJiYingSolver) Solve(ctx context.Context, image []byte) (CaptchaResult, error) {
+	response, err := s.Client.GetPicValBytes(ctx, s.User, s.Pass, s.SoftID, s.CodeType, s.MinLen, image)
+	if err != nil {
+		return CaptchaResult{}, err
+	}
+	var result models.ChaoJiYing
+	if err := json.Unmarshal(response, &result); err != nil {
+		return CaptchaResult{}, fmt.Errorf("验证码响应解析失败: %w", err)
+	}
+	if result.ErrNo != 0 {
+		return CaptchaResult{}, fmt.Errorf("超级鹰返回错误 %d: %s", result.ErrNo, result.ErrStr)
+	}
+	return CaptchaResult{Answer: result.PicStr, Ticket: result.PicID, Solver: s.Name()}, nil
+}
+
+// ReportError 按 pic_id 向超级鹰报错，err_no 为 0 表示退分成功
+func (s *ChaoJiYingSolver) ReportError(ctx context.Context, result CaptchaResult) (bool, error) {
+	if result.Ticket == "" {
+		return false, errors.New("缺少 pic_id，无法报错")
+	}
+	response, err := s.Client.ReportError(ctx, s.User, s.Pass, s.SoftID, result.Ticket)
+	if err != nil {
+		return false, err
+	}
+	var report models.ChaoJiYing
+	if err := json.Unmarshal(response, &report); err != nil {
+		return false, fmt.Errorf("报错响应解析失败: %w", err)
+	}
+	if report.ErrNo != 0 {
+		return false, fmt.Errorf("超级鹰报错失败 %d: %s", report.ErrNo, report.ErrStr)
+	}
+	return true, nil
+}
+
+// Balance 查询超级鹰账户剩余题分
+func (s *ChaoJiYingSolver) Balance(ctx context.Context) (int, error) {
+	score, err := s.Client.GetBalance(ctx, s.User, s.Pass)
+	if err != nil {
+		return 0, err
+	}
+	return score.TiFen, nil
+}
+
+// FakeCaptchaSolver 是用于测试的假识别器，按顺序循环返回预设答案，不访问任何外部服务。
+// 它不会被自动注册，避免生产环境把假答案提交给真实的 CEAC。
+type FakeCaptchaSolver struct {
+	Answers []string // 预设答案，按调用顺序循环使用
+	Err     error    // 非空时每次调用都返回该错误
+
+	mu       sync.Mutex
+	calls    int
+	reported []string
+}
+
+// NewFakeCaptchaSolver 创建返回固定答案的假识别器
+func NewFakeCaptchaSolver(answers ...string) *FakeCaptchaSolver {
+	return &FakeCaptchaSolver{Answers: answers}
+}
+
+// Name 返回识别器名称
+func (s *FakeCaptchaSolver) Name() string {
+	return "fake"
+}
+
+// Solve 返回预设答案，凭证为 fake-<调用序号>
+func (s *FakeCaptchaSolver) Solve(ctx context.Context, image []byte) (CaptchaResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.Err != nil {
+		return CaptchaResult{}, s.Err
+	}
+	if len(s.Answers) == 0 {
+		return CaptchaResult{}, errors.New("假识别器没有预设答案")
+	}
+	answer := s.Answers[(s.calls-1)%len(s.Answers)]
+	return CaptchaResult{Answer: answer, Ticket: fmt.Sprintf("fake-%d", s.calls), Solver: s.Name()}, nil
+}
+
+// Calls 返回 Solve 被调用的次数
+func (s *FakeCaptchaSolver) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// ReportError 记录被报错的凭证，总是视为退分成功
+func (s *FakeCaptchaSolver) ReportError(ctx context.Context, result CaptchaResult) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reported = append(s.reported, result.Ticket)
+	return true, nil
+}
+
+// Reported 返回所有被报错的凭证
+func (s *FakeCaptchaSolver) Reported() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.reported...)
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptchaSolverChainFallback(t *testing.T) {
+	broken := &FakeCaptchaSolver{Err: errors.New("平台不可用")}
+	backup := NewFakeCaptchaSolver("WXYZ")
+	chain := NewCaptchaSolverChain(broken, backup)
+
+	result, err := chain.Solve(context.Background(), []byte("png"))
+	if err != nil {
+		t.Fatalf("Solve() error = %v", err)
+	}
+	if result.Answer != "WXYZ" || result.Ticket != "fake-1" {
+		t.Errorf("Solve() = %+v, want answer WXYZ from backup", result)
+	}
+	if broken.Calls() != 1 || backup.Calls() != 1 {
+		t.Errorf("calls = %d, %d, want 1, 1", broken.Calls(), backup.Calls())
+	}
+}
+
+func TestCaptchaSolverChainAllFailed(t *testing.T) {
+	first := &FakeCaptchaSolver{Err: errors.New("first down")}
+	second := &FakeCaptchaSolver{Err: errors.New("second down")}
+	_, err := NewCaptchaSolverChain(first, second).Solve(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "first down") || !strings.Contains(err.Error(), "second down") {
+		t.Errorf("Solve() error = %v, want both failures", err)
+	}
+
+	if _, err := NewCaptchaSolverChain().Solve(context.Background(), nil); err == nil {
+		t.Error("empty chain: Solve() error = nil")
+	}
+}
+
+func TestCaptchaSolverChainStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	first := &FakeCaptchaSolver{Err: context.Canceled}
+	second := NewFakeCaptchaSolver("WXYZ")
+	if _, err := NewCaptchaSolverChain(first, second).Solve(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Solve() error = %v, want context.Canceled", err)
+	}
+	if second.Calls() != 0 {
+		t.Errorf("second solver called %d times after cancel", second.Calls())
+	}
+}
+
+func TestCaptchaSolverChainReportError(t *testing.T) {
+	solver := NewFakeCaptchaSolver("ABCD")
+	chain := NewCaptchaSolverChain(solver)
+	result, err := chain.Solve(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refunded, err := chain.ReportError(context.Background(), result)
+	if err != nil || !refunded {
+		t.Fatalf("ReportError() = %t, %v", refunded, err)
+	}
+	if reported := solver.Reported(); len(reported) != 1 || reported[0] != result.Ticket {
+		t.Errorf("reported = %v, want [%s]", reported, result.Ticket)
+	}
+
+	if _, err := chain.ReportError(context.Background(), CaptchaResult{Solver: "chaojiying"}); err == nil {
+		t.Error("ReportError() for a solver outside the chain: error = nil")
+	}
+}
+
+func TestNewCaptchaSolverFromEnv(t *testing.T) {
+	// 假识别器默认没有注册，不能通过配置启用
+	t.Setenv("CAPTCHA_SOLVERS", "fake")
+	if _, err := NewCaptchaSolverFromEnv(); err == nil {
+		t.Fatal("fake solver is available without registration")
+	}
+
+	RegisterCaptchaSolver("test-fallback", func() (CaptchaSolver, error) {
+		return NewFakeCaptchaSolver("WXYZ"), nil
+	})
+	t.Setenv("CAPTCHA_SOLVERS", "Test-Fallback")
+	solver, err := NewCaptchaSolverFromEnv()
+	if err != nil {
+		t.Fatalf("NewCaptchaSolverFromEnv() error = %v", err)
+	}
+	if solver.Name() != "fake" {
+		t.Errorf("Name() = %s, want fake", solver.Name())
+	}
+}
+
+func TestChaoJiYingBalanceCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	solver := &ChaoJiYingSolver{Client: NewChaoJiYing(time.Minute, "")}
+	start := time.Now()
+	if _, err := solver.Balance(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Balance() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Balance() returned after %s, want no retry wait", elapsed)
+	}
+}
+
+func TestChaoJiYingProxyReport(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"err_no":0}`))
+	}))
+	defer proxy.Close()
+	client := NewChaoJiYing(time.Second, "")
+	client.Proxies = NewProxyPool([]string{proxy.URL}, 0.3, time.Minute)
+
+	// ctx 上绑定的代理由整次查询反馈，超级鹰请求不再计数
+	req, _ := http.NewRequestWithContext(WithProxy(context.Background(), proxy.URL), "POST", "http://upload.chaojiying.net/", nil)
+	if _, err := client.do(req); err != nil {
+		t.Fatal(err)
+	}
+	if status := client.Proxies.Snapshot()[0]; status.Successes != 0 {
+		t.Errorf("successes = %d after a ctx-bound request, want 0", status.Successes)
+	}
+
+	req, _ = http.NewRequest("POST", "http://upload.chaojiying.net/", nil)
+	if _, err := client.do(req); err != nil {
+		t.Fatal(err)
+	}
+	if status := client.Proxies.Snapshot()[0]; status.Successes != 1 {
+		t.Errorf("successes = %d after a pooled request, want 1", status.Successes)
+	}
+}
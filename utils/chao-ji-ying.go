@@ -2,8 +2,12 @@ package utils
 
 import (
 	"bufio"
+	"context"
+	"crawler-visa/models"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -17,9 +21,11 @@ type ChaoJiYing struct {
 	Timeout    time.Duration
 	HttpsProxy string
 	HttpClient *http.Client
+	Proxies    *ProxyPool // 未指定 HttpsProxy 时使用的代理池，为空时直连
 }
 
-// NewChaoJiYing 初始化，可以使用代理
+// NewChaoJiYing 初始化，可以使用代理。
+// httpsProxy 为空时使用请求 ctx 上绑定的代理（见 WithProxy），没有绑定时从 Proxies 中选择。
 func NewChaoJiYing(timeout time.Duration, httpsProxy string) *ChaoJiYing {
 	client := &ChaoJiYing{Timeout: timeout, HttpsProxy: httpsProxy}
 
@@ -34,19 +40,62 @@ func NewChaoJiYing(timeout time.Duration, httpsProxy string) *ChaoJiYing {
 		} else {
 			tr.Proxy = http.ProxyURL(proxyURL)
 		}
+	} else {
+		tr.Proxy = ContextProxy
 	}
 
 	client.HttpClient = &http.Client{Transport: tr, Timeout: timeout}
 	return client
 }
 
+// do 发送请求。未指定 HttpsProxy 且请求 ctx 上没有绑定代理时从代理池中选择一个，并把结果反馈给代理池。
+// ctx 上绑定的代理由绑定方（整次状态查询）统一反馈，这里不再重复计数
+func (client *ChaoJiYing) do(req *http.Request) (*http.Response, error) {
+	if client.HttpsProxy != "" || client.Proxies == nil {
+		return client.HttpClient.Do(req)
+	}
+	if _, ok := ProxyFromContext(req.Context()); ok {
+		return client.HttpClient.Do(req)
+	}
+	proxy := client.Proxies.Pick()
+	resp, err := client.HttpClient.Do(req.WithContext(WithProxy(req.Context(), proxy)))
+	client.Proxies.Report(proxy, err)
+	return resp, err
+}
+
+// doWithRetry 发送请求，失败时间隔 2 秒重试，最多 3 次。ctx 取消后不再等待重试
+func (client *ChaoJiYing) doWithRetry(req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	var err error
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(2 * time.Second):
+			}
+			if req.GetBody != nil {
+				if req.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		resp, err = client.do(req)
+		if err == nil {
+			return resp, nil
+		}
+		log.Printf("Request failed, retrying... (%d/3)", i+1)
+	}
+	return nil, err
+}
+
 // GetScore 查询信息
-func (client *ChaoJiYing) GetScore(urlString, user, pass string) ([]byte, error) {
+func (client *ChaoJiYing) GetScore(ctx context.Context, urlString, user, pass string) ([]byte, error) {
 	parameters := url.Values{}
 	parameters.Add("user", user)
 	parameters.Add("pass", pass)
 
-	req, err := http.NewRequest("POST", urlString, strings.NewReader(parameters.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(parameters.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -55,15 +104,7 @@ func (client *ChaoJiYing) GetScore(urlString, user, pass string) ([]byte, error)
 	req.Header.Set("Connection", "Keep-Alive")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	var resp *http.Response
-	for i := 0; i < 3; i++ {
-		resp, err = client.HttpClient.Do(req)
-		if err == nil {
-			break
-		}
-		log.Printf("Request failed, retrying... (%d/3)", i+1)
-		time.Sleep(2 * time.Second)
-	}
+	resp, err := client.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +118,50 @@ func (client *ChaoJiYing) GetScore(urlString, user, pass string) ([]byte, error)
 	return body, nil
 }
 
+// ReportError 对识别错误的图片报错，超级鹰核实后返还该次消耗的题分
+func (client *ChaoJiYing) ReportError(ctx context.Context, user, pass, softid, picID string) ([]byte, error) {
+	urlString := "http://upload.chaojiying.net/Upload/ReportError.php"
+
+	parameters := url.Values{}
+	parameters.Add("user", user)
+	parameters.Add("pass", pass)
+	parameters.Add("softid", softid)
+	parameters.Add("id", picID)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(parameters.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 5.1; Trident/4.0)")
+	req.Header.Set("Connection", "Keep-Alive")
+
+	resp, err := client.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// GetBalance 查询账户剩余题分并解析返回结果
+func (client *ChaoJiYing) GetBalance(ctx context.Context, user, pass string) (models.ChaoJiYingScore, error) {
+	var score models.ChaoJiYingScore
+	body, err := client.GetScore(ctx, "http://upload.chaojiying.net/Upload/GetScore.php", user, pass)
+	if err != nil {
+		return score, err
+	}
+	if err := json.Unmarshal(body, &score); err != nil {
+		return score, fmt.Errorf("题分响应解析失败: %w", err)
+	}
+	if score.ErrNo != 0 {
+		return score, fmt.Errorf("超级鹰返回错误 %d: %s", score.ErrNo, score.ErrStr)
+	}
+	return score, nil
+}
+
 // 文件转码base64字符串
 func getEncodedBase64(filename string) (string, error) {
 	f, err := os.Open(filename)
@@ -97,13 +182,23 @@ func getEncodedBase64(filename string) (string, error) {
 
 // GetPicVal 发出请求获得json结果
 func (client *ChaoJiYing) GetPicVal(user, pass, softid, codetype, len_min, filename string) ([]byte, error) {
-	urlString := "http://upload.chaojiying.net/Upload/Processing.php"
-
 	encodedFile, err := getEncodedBase64(filename)
 	if err != nil {
 		return nil, err
 	}
 
+	return client.postPicVal(context.Background(), user, pass, softid, codetype, len_min, encodedFile)
+}
+
+// GetPicValBytes 直接上传内存中的图片数据，省去落盘步骤
+func (client *ChaoJiYing) GetPicValBytes(ctx context.Context, user, pass, softid, codetype, len_min string, image []byte) ([]byte, error) {
+	encodedFile := base64.StdEncoding.EncodeToString(image)
+	return client.postPicVal(ctx, user, pass, softid, codetype, len_min, encodedFile)
+}
+
+func (client *ChaoJiYing) postPicVal(ctx context.Context, user, pass, softid, codetype, len_min, encodedFile string) ([]byte, error) {
+	urlString := "http://upload.chaojiying.net/Upload/Processing.php"
+
 	parameters := url.Values{}
 	parameters.Add("user", user)
 	parameters.Add("pass", pass)
@@ -112,7 +207,7 @@ func (client *ChaoJiYing) GetPicVal(user, pass, softid, codetype, len_min, filen
 	parameters.Add("len_min", len_min)
 	parameters.Add("file_base64", encodedFile)
 
-	req, err := http.NewRequest("POST", urlString, strings.NewReader(parameters.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(parameters.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -121,15 +216,7 @@ func (client *ChaoJiYing) GetPicVal(user, pass, softid, codetype, len_min, filen
 	req.Header.Set("User-Agent", "Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 5.1; Trident/4.0)")
 	req.Header.Set("Connection", "Keep-Alive")
 
-	var resp *http.Response
-	for i := 0; i < 3; i++ {
-		resp, err = client.HttpClient.Do(req)
-		if err == nil {
-			break
-		}
-		log.Printf("Request failed, retrying... (%d/3)", i+1)
-		time.Sleep(2 * time.Second)
-	}
+	resp, err := client.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// 这里只实现了解析 CEAC 这类 ASP.NET WebForms 页面所需的最少功能：
+// 按 #id 或 .class 查找元素、读取属性和文本、收集隐藏字段。
+// 页面结构简单且固定，因此没有引入完整的 HTML 解析库。
+
+var (
+	tagPattern  = regexp.MustCompile(`(?is)<(/?)([a-zA-Z][a-zA-Z0-9]*)([^>]*?)(/?)>`)
+	attrPattern = regexp.MustCompile(`(?is)([a-zA-Z_:][-a-zA-Z0-9_:.$]*)\s*=\s*("([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	stripTags   = regexp.MustCompile(`(?s)<[^>]*>`)
+	// 以下用于把邮件等 HTML 转换为按行排列的纯文本
+	invisibleBlocks = regexp.MustCompile(`(?is)<(script|style|head|title)\b[^>]*>.*?</(script|style|head|title)>|<!--.*?-->`)
+	lineBreakTags   = regexp.MustCompile(`(?i)<br\s*/?>|</?(p|div|tr|li|h[1-6]|table|ul|ol|blockquote)\b[^>]*>`)
+	cellTags        = regexp.MustCompile(`(?i)</t[dh]\s*>`)
+	// simpleSelector matchSelector 支持的选择器语法
+	simpleSelector = regexp.MustCompile(`^(#[A-Za-z_][-\w]*|\.[A-Za-z_][-\w]*|\[[A-Za-z_:][-\w:.]*(=("[^"]*"|'[^']*'|[^\]"'\s]+))?\])$`)
+)
+
+// voidElements 没有结束标签的 HTML 元素
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// HTMLElement 页面中的一个元素
+type HTMLElement struct {
+	Tag   string            // 标签名（小写）
+	Attrs map[string]string // 属性，值已反转义
+	Inner string            // 元素内部的原始 HTML
+}
+
+// Text 返回元素的纯文本内容，去掉标签并合并多余空白
+func (e *HTMLElement) Text() string {
+	text := html.UnescapeString(stripTags.ReplaceAllString(e.Inner, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// parseAttrs 解析标签中的属性
+func parseAttrs(raw string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrPattern.FindAllStringSubmatch(raw, -1) {
+		value := m[3]
+		if value == "" {
+			value = m[4]
+		}
+		if value == "" {
+			value = m[5]
+		}
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(value)
+	}
+	return attrs
+}
+
+// ValidateSelector 检查选择器是否为 FindElement 支持的简单选择器：#id、.class、[name] 或 [name=value]。
+// 组合选择器（如 select#id、div .x）在浏览器中可用，但这里无法解析，会被当作找不到元素
+func ValidateSelector(selector string) error {
+	if !simpleSelector.MatchString(selector) {
+		return fmt.Errorf("不支持的选择器 %q，只支持 #id、.class、[name] 和 [name=value]", selector)
+	}
+	return nil
+}
+
+// matchSelector 判断属性是否满足简单选择器，支持 #id、.class、[name] 和 [name=value]
+func matchSelector(attrs map[string]string, selector string) bool {
+	switch {
+	case strings.HasPrefix(selector, "#"):
+		return attrs["id"] == selector[1:]
+	case strings.HasPrefix(selector, "."):
+		for _, class := range strings.Fields(attrs["class"]) {
+			if class == selector[1:] {
+				return true
+			}
+		}
+		return false
+	case strings.HasPrefix(selector, "[") && strings.HasSuffix(selector, "]"):
+		name, value, hasValue := strings.Cut(selector[1:len(selector)-1], "=")
+		actual, ok := attrs[strings.ToLower(name)]
+		if !hasValue {
+			return ok
+		}
+		return actual == strings.Trim(value, `"'`)
+	default:
+		return false
+	}
+}
+
+// FindElement 返回第一个匹配选择器的元素，未找到时返回 nil。
+// 参数:
+//
+//	page string - 页面 HTML。
+//	selector string - 简单选择器，支持 #id、.class、[name] 和 [name=value]。
+//
+// 返回值:
+//
+//	*HTMLElement - 匹配的元素。
+//
+// 示例:
+//
+//	el := FindElement(page, "#ctl00_ContentPlaceHolder1_lblError")
+//	if el != nil {
+//	    fmt.Println(el.Text())
+//	}
+func FindElement(page, selector string) *HTMLElement {
+	elements := FindElements(page, selector, 1)
+	if len(elements) == 0 {
+		return nil
+	}
+	return elements[0]
+}
+
+// FindElements 返回最多 limit 个匹配选择器的元素，limit 小于等于 0 表示不限制
+func FindElements(page, selector string, limit int) []*HTMLElement {
+	var elements []*HTMLElement
+	tags := tagPattern.FindAllStringSubmatchIndex(page, -1)
+	for i, loc := range tags {
+		if page[loc[2]:loc[3]] == "/" {
+			continue
+		}
+		tag := strings.ToLower(page[loc[4]:loc[5]])
+		attrs := parseAttrs(page[loc[6]:loc[7]])
+		if !matchSelector(attrs, selector) {
+			continue
+		}
+		el := &HTMLElement{Tag: tag, Attrs: attrs}
+		if !voidElements[tag] && page[loc[8]:loc[9]] != "/" {
+			el.Inner = innerHTML(page, tags[i+1:], tag, loc[1])
+		}
+		elements = append(elements, el)
+		if limit > 0 && len(elements) >= limit {
+			break
+		}
+	}
+	return elements
+}
+
+// innerHTML 从 start 开始查找与之配对的结束标签，返回其间的内容
+func innerHTML(page string, rest [][]int, tag string, start int) string {
+	depth := 1
+	for _, loc := range rest {
+		if strings.ToLower(page[loc[4]:loc[5]]) != tag {
+			continue
+		}
+		if page[loc[2]:loc[3]] == "/" {
+			depth--
+			if depth == 0 {
+				return page[start:loc[0]]
+			}
+		} else if page[loc[8]:loc[9]] != "/" {
+			depth++
+		}
+	}
+	return page[start:]
+}
+
+// FormFields 收集页面中所有 input 的 name/value，包括 __VIEWSTATE、__EVENTVALIDATION 等隐藏字段，
+// 以及所有 select 当前选中的值，用于回传 ASP.NET 表单
+func FormFields(page string) map[string]string {
+	fields := make(map[string]string)
+	for _, loc := range tagPattern.FindAllStringSubmatchIndex(page, -1) {
+		if page[loc[2]:loc[3]] == "/" {
+			continue
+		}
+		tag := strings.ToLower(page[loc[4]:loc[5]])
+		attrs := parseAttrs(page[loc[6]:loc[7]])
+		name := attrs["name"]
+		if name == "" {
+			continue
+		}
+		switch tag {
+		case "input":
+			switch strings.ToLower(attrs["type"]) {
+			case "image", "submit", "button", "checkbox", "radio":
+				continue
+			}
+			fields[name] = attrs["value"]
+		}
+	}
+	for _, sel := range FindElements(page, "[name]", 0) {
+		if sel.Tag == "select" {
+			fields[sel.Attrs["name"]] = selectedOption(sel.Inner)
+		}
+	}
+	return fields
+}
+
+var selectedAttr = regexp.MustCompile(`(?i)(^|\s)selected(\s|=|$)`)
+
+// selectedOption 返回 select 中被选中的 option 的值，没有显式选中时返回第一个 option 的值
+func selectedOption(inner string) string {
+	first, found := "", false
+	for _, loc := range tagPattern.FindAllStringSubmatchIndex(inner, -1) {
+		if inner[loc[2]:loc[3]] == "/" || strings.ToLower(inner[loc[4]:loc[5]]) != "option" {
+			continue
+		}
+		raw := inner[loc[6]:loc[7]]
+		value := parseAttrs(raw)["value"]
+		if selectedAttr.MatchString(raw) {
+			return value
+		}
+		if !found {
+			first, found = value, true
+		}
+	}
+	return first
+}
+
+// HTMLToText 把 HTML 转换为纯文本：去掉脚本、样式和注释，块级元素和 <br> 换行，表格单元格之间以空格分隔，
+// 每行合并多余空白，去掉空行
+func HTMLToText(page string) string {
+	page = invisibleBlocks.ReplaceAllString(page, "")
+	page = lineBreakTags.ReplaceAllString(page, "\n")
+	page = cellTags.ReplaceAllString(page, " ")
+	text := html.UnescapeString(stripTags.ReplaceAllString(page, ""))
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -7,9 +7,10 @@ import (
 
 // ResultData 定义统一的响应结构
 type ResultData struct {
-	Message string      `json:"message"` // 响应消息
-	Data    interface{} `json:"data"`    // 响应数据
-	Code    int         `json:"code"`
+	Message   string      `json:"message"`              // 响应消息
+	Data      interface{} `json:"data"`                 // 响应数据
+	Code      int         `json:"code"`                 // HTTP 状态码
+	ErrorCode string      `json:"error_code,omitempty"` // 稳定的业务错误码，仅在出错时返回
 }
 
 func ResultJSON(w http.ResponseWriter, data interface{}, message string, optionalStatus ...int) {
@@ -17,7 +18,21 @@ func ResultJSON(w http.ResponseWriter, data interface{}, message string, optiona
 	if len(optionalStatus) > 0 {
 		status = optionalStatus[0] // 如果提供了状态码，则使用提供的状态码
 	}
+	writeResult(w, data, message, "", status)
+}
 
+// ResultError 用于发送错误响应
+func ResultError(w http.ResponseWriter, message string, status int) {
+	ResultJSON(w, nil, message, status)
+}
+
+// ResultErrorCode 用于发送带业务错误码的错误响应，调用方可根据 errorCode 判断失败原因
+func ResultErrorCode(w http.ResponseWriter, message, errorCode string, status int) {
+	writeResult(w, nil, message, errorCode, status)
+}
+
+// writeResult 按 ResultData 的格式写出响应，所有 Result* 函数都经过这里，errorCode 为空时不输出该字段
+func writeResult(w http.ResponseWriter, data interface{}, message, errorCode string, status int) {
 	// 检查 data 是否为 string 类型
 	if jsonData, ok := data.(string); ok {
 		var parsedData interface{}
@@ -29,16 +44,12 @@ func ResultJSON(w http.ResponseWriter, data interface{}, message string, optiona
 	}
 
 	response := ResultData{
-		Code:    status,
-		Message: message,
-		Data:    data,
+		Code:      status,
+		Message:   message,
+		Data:      data,
+		ErrorCode: errorCode,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(response)
 }
-
-// ResultError 用于发送错误响应
-func ResultError(w http.ResponseWriter, message string, status int) {
-	ResultJSON(w, nil, message, status)
-}
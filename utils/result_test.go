@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestResultShape 错误码只是可选字段，带不带错误码的响应结构相同
+func TestResultShape(t *testing.T) {
+	decode := func(rec *httptest.ResponseRecorder) map[string]interface{} {
+		t.Helper()
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	rec := httptest.NewRecorder()
+	ResultJSON(rec, `{"status":"Issued"}`, "ok")
+	body := decode(rec)
+	if rec.Code != http.StatusOK || body["code"] != float64(200) || body["message"] != "ok" {
+		t.Errorf("ResultJSON = %d %v", rec.Code, body)
+	}
+	if data, _ := body["data"].(map[string]interface{}); data["status"] != "Issued" {
+		t.Errorf("ResultJSON data = %v, want parsed JSON", body["data"])
+	}
+	if _, ok := body["error_code"]; ok {
+		t.Errorf("ResultJSON body has error_code: %v", body)
+	}
+
+	rec = httptest.NewRecorder()
+	ResultErrorCode(rec, "not found", "APPLICATION_NOT_FOUND", http.StatusNotFound)
+	body = decode(rec)
+	if rec.Code != http.StatusNotFound || body["code"] != float64(404) || body["error_code"] != "APPLICATION_NOT_FOUND" {
+		t.Errorf("ResultErrorCode = %d %v", rec.Code, body)
+	}
+	for _, key := range []string{"message", "data", "code"} {
+		if _, ok := body[key]; !ok {
+			t.Errorf("ResultErrorCode body missing %q: %v", key, body)
+		}
+	}
+}